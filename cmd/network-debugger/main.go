@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -75,6 +76,36 @@ func main() {
 		}()
 	}
 
+	// Optional SOCKS5 listener sharing the forward-proxy capture and MITM
+	var socksLn net.Listener
+	if cfg.SOCKSAddr != "" {
+		ln, err := net.Listen("tcp", cfg.SOCKSAddr)
+		if err != nil {
+			logger.Error().Err(err).Str("addr", cfg.SOCKSAddr).Msg("socks listener failed")
+			os.Exit(1)
+		}
+		socksLn = ln
+		go func() {
+			logger.Info().Str("addr", cfg.SOCKSAddr).Msg("starting SOCKS5 listener")
+			_ = deps.ServeSOCKS5(ln)
+		}()
+	}
+
+	// Optional transparent TLS listener (SNI-routed interception without proxy settings)
+	var transparentLn net.Listener
+	if cfg.TransparentTLSAddr != "" {
+		ln, err := net.Listen("tcp", cfg.TransparentTLSAddr)
+		if err != nil {
+			logger.Error().Err(err).Str("addr", cfg.TransparentTLSAddr).Msg("transparent TLS listener failed")
+			os.Exit(1)
+		}
+		transparentLn = ln
+		go func() {
+			logger.Info().Str("addr", cfg.TransparentTLSAddr).Msg("starting transparent TLS listener")
+			_ = deps.ServeTransparentTLS(ln)
+		}()
+	}
+
 	// Graceful shutdown
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -112,6 +143,12 @@ func main() {
 			logger.Error().Err(err).Msg("tls server shutdown error")
 		}
 	}
+	if socksLn != nil {
+		_ = socksLn.Close()
+	}
+	if transparentLn != nil {
+		_ = transparentLn.Close()
+	}
 	logger.Info().Msg("network-debugger stopped")
 }
 
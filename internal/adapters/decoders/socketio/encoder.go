@@ -0,0 +1,49 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// EncodeEvent builds the Engine.IO message + Socket.IO EVENT packet ("42") for emitting event
+// with args on namespace ("" or "/" is the main namespace), requesting an ack when ackID is set:
+//
+//	42[/nsp,][ack]["event",arg1,...]
+//
+// Args must be JSON values; binary attachments are not supported.
+func EncodeEvent(namespace, event string, args []json.RawMessage, ackID *int64) (string, error) {
+	if event == "" {
+		return "", errors.New("socketio: empty event name")
+	}
+	name, _ := json.Marshal(event)
+	arr := []json.RawMessage{name}
+	for i, a := range args {
+		if !json.Valid(a) {
+			return "", errors.New("socketio: arg " + strconv.Itoa(i) + " is not valid JSON")
+		}
+		arr = append(arr, a)
+	}
+	payload, err := json.Marshal(arr)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("42")
+	if namespace != "" && namespace != "/" {
+		if !strings.HasPrefix(namespace, "/") {
+			b.WriteByte('/')
+		}
+		b.WriteString(namespace)
+		b.WriteByte(',')
+	}
+	if ackID != nil {
+		if *ackID < 0 {
+			return "", errors.New("socketio: negative ack id")
+		}
+		b.WriteString(strconv.FormatInt(*ackID, 10))
+	}
+	b.Write(payload)
+	return b.String(), nil
+}
@@ -0,0 +1,37 @@
+package socketio
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodeEventRoundTrip(t *testing.T) {
+	ack := int64(7)
+	cases := []struct {
+		nsp  string
+		ack  *int64
+		want string
+	}{
+		{"", nil, `42["chat",{"text":"hi"},2]`},
+		{"/", nil, `42["chat",{"text":"hi"},2]`},
+		{"admin", &ack, `42/admin,7["chat",{"text":"hi"},2]`},
+	}
+	for _, c := range cases {
+		got, err := EncodeEvent(c.nsp, "chat", []json.RawMessage{json.RawMessage(`{"text": "hi"}`), json.RawMessage(`2`)}, c.ack)
+		if err != nil || got != c.want {
+			t.Fatalf("EncodeEvent(%q): %q %v, want %q", c.nsp, got, err, c.want)
+		}
+		if _, ev, _, ok := ParseEvent(got); !ok || ev != "chat" {
+			t.Fatalf("encoded packet does not parse: %q", got)
+		}
+	}
+}
+
+func TestEncodeEventRejectsInvalidArgs(t *testing.T) {
+	if _, err := EncodeEvent("", "", nil, nil); err == nil {
+		t.Fatalf("expected an error for an empty event")
+	}
+	if _, err := EncodeEvent("", "x", []json.RawMessage{json.RawMessage(`{`)}, nil); err == nil {
+		t.Fatalf("expected an error for invalid JSON")
+	}
+}
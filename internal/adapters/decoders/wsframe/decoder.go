@@ -0,0 +1,291 @@
+// Package wsframe decodes a raw RFC 6455 byte stream (one direction of an upgraded connection)
+// into messages: frames are unmasked, fragments reassembled and permessage-deflate (RFC 7692)
+// payloads inflated. The decoder only observes bytes; it never alters the stream.
+package wsframe
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// Opcodes (RFC 6455 §5.2).
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// DefaultMaxMessageBytes bounds the payload buffered for one message.
+const DefaultMaxMessageBytes = 4 << 20
+
+// inflateWindow is the LZ77 window kept between messages (context takeover).
+const inflateWindow = 32 << 10
+
+// Message is one decoded data message or control frame.
+type Message struct {
+	Opcode byte
+	// Data is the unmasked (and inflated) payload; nil when the message was too large.
+	Data []byte
+	// Size is the payload size on the wire (sum of fragments, before inflating).
+	Size int
+	// Compressed reports a permessage-deflate message.
+	Compressed bool
+	// Truncated reports that Data was dropped because the message exceeded the limit.
+	Truncated bool
+}
+
+// Decoder is an io.Writer fed with the bytes of one direction; emit is called for every
+// complete message in stream order.
+type Decoder struct {
+	emit     func(Message)
+	deflate  bool
+	maxBytes int
+
+	buf []byte
+	// skip counts payload bytes of an oversized frame still to be discarded
+	skip uint64
+
+	msgOp         byte
+	msg           []byte
+	msgSize       int
+	msgCompressed bool
+	msgTruncated  bool
+	inMsg         bool
+	// pendingFin: the oversized frame being skipped ends its message
+	pendingFin bool
+
+	window []byte
+	// inflateBroken: context was lost (oversized compressed message), later messages cannot be inflated
+	inflateBroken bool
+	broken        bool
+}
+
+// NewDecoder creates a decoder; deflate enables permessage-deflate (see Negotiated).
+func NewDecoder(deflate bool, emit func(Message)) *Decoder {
+	return &Decoder{emit: emit, deflate: deflate, maxBytes: DefaultMaxMessageBytes}
+}
+
+// SetMaxMessageBytes changes the per-message buffering limit.
+func (d *Decoder) SetMaxMessageBytes(n int) {
+	if n > 0 {
+		d.maxBytes = n
+	}
+}
+
+// Negotiated reports whether a handshake response header value of Sec-WebSocket-Extensions
+// enables permessage-deflate.
+func Negotiated(extensions string) bool {
+	for _, ext := range strings.Split(extensions, ",") {
+		name, _, _ := strings.Cut(ext, ";")
+		if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
+// Write consumes stream bytes; it never fails so it can sit behind io.TeeReader.
+// A protocol violation stops decoding for the rest of the stream.
+func (d *Decoder) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && !d.broken {
+		if d.skip > 0 {
+			k := d.skip
+			if k > uint64(len(p)) {
+				k = uint64(len(p))
+			}
+			d.skip -= k
+			p = p[k:]
+			if d.skip == 0 {
+				d.oversizedDone()
+			}
+			continue
+		}
+		d.buf = append(d.buf, p...)
+		p = nil
+		for !d.broken && d.skip == 0 && d.next() {
+		}
+		if d.skip > 0 {
+			// the rest of the buffer belongs to the oversized payload
+			rest := d.buf
+			d.buf = nil
+			p = rest
+		}
+	}
+	return n, nil
+}
+
+type frameHeader struct {
+	fin  bool
+	rsv1 bool
+	op   byte
+	size uint64
+}
+
+// next parses one complete frame from buf; false when more bytes are needed.
+func (d *Decoder) next() bool {
+	b := d.buf
+	if len(b) < 2 {
+		return false
+	}
+	h := frameHeader{fin: b[0]&0x80 != 0, rsv1: b[0]&0x40 != 0, op: b[0] & 0x0f}
+	masked := b[1]&0x80 != 0
+	off := 2
+	switch l := b[1] & 0x7f; l {
+	case 126:
+		if len(b) < off+2 {
+			return false
+		}
+		h.size = uint64(binary.BigEndian.Uint16(b[off:]))
+		off += 2
+	case 127:
+		if len(b) < off+8 {
+			return false
+		}
+		h.size = binary.BigEndian.Uint64(b[off:])
+		off += 8
+	default:
+		h.size = uint64(l)
+	}
+	var key []byte
+	if masked {
+		if len(b) < off+4 {
+			return false
+		}
+		key = b[off : off+4]
+		off += 4
+	}
+	if h.op >= OpClose && (!h.fin || h.size > 125) {
+		d.broken = true
+		return false
+	}
+	if h.op < OpClose && d.tooLarge(h) {
+		d.buf = d.buf[off:]
+		d.startOversized(h)
+		return false
+	}
+	if uint64(len(b)-off) < h.size {
+		return false
+	}
+	payload := make([]byte, h.size)
+	copy(payload, b[off:off+int(h.size)])
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i&3]
+		}
+	}
+	d.buf = b[off+int(h.size):]
+	if len(d.buf) == 0 {
+		d.buf = nil
+	}
+	d.frame(h, payload)
+	return true
+}
+
+func (d *Decoder) tooLarge(h frameHeader) bool {
+	return h.size > uint64(d.maxBytes) || (h.op == OpContinuation && d.inMsg && uint64(len(d.msg))+h.size > uint64(d.maxBytes))
+}
+
+func (d *Decoder) frame(h frameHeader, payload []byte) {
+	switch {
+	case h.op >= OpClose:
+		// control frames may be interleaved with fragments of a data message
+		d.emit(Message{Opcode: h.op, Data: payload, Size: len(payload)})
+		return
+	case h.op == OpContinuation:
+		if !d.inMsg {
+			d.broken = true
+			return
+		}
+		d.msgSize += len(payload)
+		if !d.msgTruncated {
+			d.msg = append(d.msg, payload...)
+		}
+	case h.op == OpText || h.op == OpBinary:
+		d.inMsg = true
+		d.msgOp, d.msg, d.msgSize = h.op, payload, len(payload)
+		d.msgCompressed = h.rsv1 && d.deflate
+		d.msgTruncated = false
+	default:
+		d.broken = true
+		return
+	}
+	if h.fin {
+		d.finishMessage()
+	}
+}
+
+// startOversized begins skipping a payload that exceeds the limit; the message is reported
+// with its size but without data.
+func (d *Decoder) startOversized(h frameHeader) {
+	if h.op != OpContinuation {
+		d.inMsg = true
+		d.msgOp, d.msgSize = h.op, 0
+		d.msgCompressed = h.rsv1 && d.deflate
+	}
+	d.msg = nil
+	d.msgTruncated = true
+	d.msgSize += int(h.size)
+	d.pendingFin = h.fin
+	d.skip = h.size
+	if d.skip == 0 {
+		d.oversizedDone()
+	}
+}
+
+func (d *Decoder) oversizedDone() {
+	if d.pendingFin {
+		d.finishMessage()
+	}
+}
+
+func (d *Decoder) finishMessage() {
+	m := Message{Opcode: d.msgOp, Data: d.msg, Size: d.msgSize, Compressed: d.msgCompressed, Truncated: d.msgTruncated}
+	if m.Compressed {
+		switch {
+		case m.Truncated:
+			// the inflate window is unknown from now on
+			d.inflateBroken = true
+		case d.inflateBroken:
+			m.Data, m.Truncated = nil, true
+		default:
+			if out, ok := d.inflate(m.Data); ok {
+				m.Data = out
+			} else {
+				d.inflateBroken = true
+				m.Data, m.Truncated = nil, true
+			}
+		}
+	}
+	d.inMsg, d.msg, d.msgSize, d.msgTruncated, d.pendingFin = false, nil, 0, false, false
+	d.emit(m)
+}
+
+// inflate decompresses one message. The previous output is used as dictionary, which covers
+// both context takeover and no_context_takeover (no back-references then).
+func (d *Decoder) inflate(p []byte) ([]byte, bool) {
+	in := make([]byte, 0, len(p)+4)
+	in = append(in, p...)
+	in = append(in, 0x00, 0x00, 0xff, 0xff)
+	fr := flate.NewReaderDict(bytes.NewReader(in), d.window)
+	defer fr.Close()
+	out, err := io.ReadAll(io.LimitReader(fr, int64(d.maxBytes)+1))
+	// the stream ends after the sync flush block, without a final block
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, false
+	}
+	if len(out) > d.maxBytes {
+		return nil, false
+	}
+	d.window = append(d.window, out...)
+	if len(d.window) > inflateWindow {
+		d.window = append([]byte(nil), d.window[len(d.window)-inflateWindow:]...)
+	}
+	return out, true
+}
@@ -0,0 +1,119 @@
+package wsframe
+
+import (
+	"bytes"
+	"compress/flate"
+	"testing"
+)
+
+func frame(fin, rsv1 bool, op byte, payload []byte, mask []byte) []byte {
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	if rsv1 {
+		b0 |= 0x40
+	}
+	out := []byte{b0}
+	var mbit byte
+	if mask != nil {
+		mbit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		out = append(out, mbit|byte(n))
+	case n < 1<<16:
+		out = append(out, mbit|126, byte(n>>8), byte(n))
+	default:
+		out = append(out, mbit|127, 0, 0, 0, 0, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	if mask != nil {
+		out = append(out, mask...)
+		p := append([]byte(nil), payload...)
+		for i := range p {
+			p[i] ^= mask[i&3]
+		}
+		return append(out, p...)
+	}
+	return append(out, payload...)
+}
+
+func collect(deflate bool) (*Decoder, *[]Message) {
+	var got []Message
+	return NewDecoder(deflate, func(m Message) { got = append(got, m) }), &got
+}
+
+func TestDecoderMaskedFragmentsWithInterleavedPing(t *testing.T) {
+	d, got := collect(false)
+	key := []byte{1, 2, 3, 4}
+	var stream []byte
+	stream = append(stream, frame(false, false, OpText, []byte("42[\"hel"), key)...)
+	stream = append(stream, frame(true, false, OpPing, []byte("p"), key)...)
+	stream = append(stream, frame(true, false, OpContinuation, []byte("lo\"]"), key)...)
+	stream = append(stream, frame(true, false, OpBinary, bytes.Repeat([]byte{7}, 300), nil)...)
+	// feed byte by byte: frames split at every boundary
+	for i := range stream {
+		_, _ = d.Write(stream[i : i+1])
+	}
+	if len(*got) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(*got))
+	}
+	if m := (*got)[0]; m.Opcode != OpPing || string(m.Data) != "p" {
+		t.Fatalf("unexpected ping: %+v", m)
+	}
+	if m := (*got)[1]; m.Opcode != OpText || string(m.Data) != `42["hello"]` {
+		t.Fatalf("unexpected text: %q", m.Data)
+	}
+	if m := (*got)[2]; m.Opcode != OpBinary || len(m.Data) != 300 {
+		t.Fatalf("unexpected binary: op=%d len=%d", m.Opcode, len(m.Data))
+	}
+}
+
+func TestDecoderPermessageDeflateContextTakeover(t *testing.T) {
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	compress := func(s string) []byte {
+		buf.Reset()
+		_, _ = fw.Write([]byte(s))
+		_ = fw.Flush()
+		return bytes.TrimSuffix(append([]byte(nil), buf.Bytes()...), []byte{0, 0, 0xff, 0xff})
+	}
+	msg := `{"event":"update","payload":{"price":101.5,"symbol":"ABC"}}`
+	first, second := compress(msg), compress(msg)
+	if len(second) >= len(first) {
+		t.Fatalf("second message should reference the shared window")
+	}
+	d, got := collect(true)
+	_, _ = d.Write(frame(true, true, OpText, first, nil))
+	_, _ = d.Write(frame(true, true, OpText, second, nil))
+	if len(*got) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(*got))
+	}
+	for _, m := range *got {
+		if !m.Compressed || string(m.Data) != msg {
+			t.Fatalf("unexpected message: %+v %q", m, m.Data)
+		}
+	}
+}
+
+func TestDecoderOversizedMessageIsReportedWithoutData(t *testing.T) {
+	d, got := collect(false)
+	d.SetMaxMessageBytes(16)
+	_, _ = d.Write(frame(true, false, OpBinary, bytes.Repeat([]byte{1}, 40), nil))
+	_, _ = d.Write(frame(true, false, OpText, []byte("ok"), nil))
+	if len(*got) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(*got))
+	}
+	if m := (*got)[0]; !m.Truncated || m.Data != nil || m.Size != 40 {
+		t.Fatalf("unexpected oversized message: %+v", m)
+	}
+	if m := (*got)[1]; string(m.Data) != "ok" {
+		t.Fatalf("decoder lost sync after oversized frame: %+v", m)
+	}
+}
+
+func TestNegotiated(t *testing.T) {
+	if !Negotiated("permessage-deflate; client_max_window_bits") || Negotiated("x-webkit-deflate-frame") || Negotiated("") {
+		t.Fatalf("unexpected negotiation result")
+	}
+}
@@ -156,6 +156,15 @@ func (s *Store) ListSessions(ctx context.Context, f usecase.SessionFilter) ([]do
 				}
 			}
 		}
+		if f.ChainID != "" && e.session.ChainID != f.ChainID {
+			continue
+		}
+		if f.User != "" && e.session.User != f.User {
+			continue
+		}
+		if f.ClientID != "" && e.session.ClientID != f.ClientID {
+			continue
+		}
 		// target filter: allow substring (case-insensitive) to match domain/URL parts
 		if f.Target != "" && !containsFold(e.session.Target, f.Target) {
 			continue
@@ -205,6 +214,15 @@ func (s *Store) SetClosed(ctx context.Context, id string, ts time.Time, errMsg *
 	return nil
 }
 
+func (s *Store) UpdateSession(ctx context.Context, id string, fn func(*domain.Session)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[id]; ok {
+		fn(&e.session)
+	}
+	return nil
+}
+
 // FrameRepository
 func (s *Store) AppendFrame(ctx context.Context, sessionID string, f domain.Frame) error {
 	s.mu.Lock()
@@ -300,6 +318,20 @@ func (s *Store) AppendHTTPTransaction(ctx context.Context, tx domain.HTTPTransac
 	return nil
 }
 
+func (s *Store) UpdateHTTPTransaction(ctx context.Context, tx domain.HTTPTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[tx.SessionID]; ok {
+		for i := range e.httpTxs {
+			if e.httpTxs[i].ID == tx.ID {
+				e.httpTxs[i] = tx
+				break
+			}
+		}
+	}
+	return nil
+}
+
 func (s *Store) ListHTTPTransactions(ctx context.Context, sessionID string, from string, limit int) ([]domain.HTTPTransaction, string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -10,6 +10,8 @@ type Event struct {
     AckID      *int64    `json:"ackId,omitempty"`
     ArgsPreview string   `json:"argsPreview"`
     FrameIDs   []string  `json:"frameIds"`
+    // SSEID is the "id:" field of a Server-Sent Event (Namespace "sse").
+    SSEID      string    `json:"sseId,omitempty"`
 }
 
 
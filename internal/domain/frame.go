@@ -9,6 +9,12 @@ type Frame struct {
     Opcode    Opcode    `json:"opcode"`
     Size      int       `json:"size"`
     Preview   string    `json:"preview"`
+    // Edited marks a message changed at a breakpoint before it was forwarded; Dropped one that
+    // was held and never forwarded.
+    Edited    bool      `json:"edited,omitempty"`
+    Dropped   bool      `json:"dropped,omitempty"`
+    // Injected marks a frame sent via the API rather than proxied.
+    Injected  bool      `json:"injected,omitempty"`
 }
 
 
@@ -17,15 +17,51 @@ type HTTPTransaction struct {
     ContentType string   `json:"contentType,omitempty"`
     ReqBodyFile string   `json:"reqBodyFile,omitempty"`
     RespBodyFile string  `json:"respBodyFile,omitempty"`
+    // ReqBodyTruncated / RespBodyTruncated: the stored copy was cut at BODY_MAX_BYTES
+    // (the proxied traffic itself is never truncated).
+    ReqBodyTruncated  bool `json:"reqBodyTruncated,omitempty"`
+    RespBodyTruncated bool `json:"respBodyTruncated,omitempty"`
+    // ServerIPAddress is the IP of the connection that served the request (HAR serverIPAddress).
+    ServerIPAddress string `json:"serverIPAddress,omitempty"`
+    // ConnReused reports a kept-alive upstream connection was reused; ConnID identifies it.
+    ConnReused bool   `json:"connReused"`
+    ConnID     string `json:"connId,omitempty"`
+    // Protocol is the negotiated upstream protocol ("http/1.1", "h2").
+    Protocol string `json:"protocol,omitempty"`
+    // ClientProtocol is the protocol spoken by the client ("http/1.1", "h2");
+    // StreamID is the client's HTTP/2 stream carrying an intercepted (MITM) exchange.
+    ClientProtocol string `json:"clientProtocol,omitempty"`
+    StreamID       uint32 `json:"streamId,omitempty"`
+    // TLS describes the upstream TLS connection (nil for plain http or when it failed).
+    TLS *TLSInfo `json:"tls,omitempty"`
+    // Error / ErrorCode classify a failed exchange (see humanizeProxyError); Status is 0 then.
+    Error     string `json:"error,omitempty"`
+    ErrorCode string `json:"errorCode,omitempty"`
+    // ReqHeaders keeps the outbound request headers (unmasked) so the exchange can be replayed.
+    ReqHeaders map[string][]string `json:"-"`
 }
 
-// HTTPTimings captures coarse-grained timing milestones for a transaction.
+// HTTPTimings captures the timing phases of a transaction (all in ms, 0 when a phase did not happen,
+// e.g. DNS/Connect/TLS on a reused connection).
 type HTTPTimings struct {
+    Blocked  int64 `json:"blockedMs"`  // Waiting for a connection (queueing / pool limits)
     DNS      int64 `json:"dnsMs"`      // DNS resolve duration in ms
-    Connect  int64 `json:"connectMs"`  // TCP connect duration in ms
+    Connect  int64 `json:"connectMs"`  // TCP connect duration in ms (without TLS)
     TLS      int64 `json:"tlsMs"`      // TLS handshake duration in ms
+    Send     int64 `json:"sendMs"`     // Writing request headers and body
+    Wait     int64 `json:"waitMs"`     // Request written -> first response byte (server time)
+    Receive  int64 `json:"receiveMs"`  // First response byte -> end of body
     TTFB     int64 `json:"ttfbMs"`     // Time to first byte (headers) in ms
-    Total    int64 `json:"totalMs"`    // Total duration in ms (start->headers)
+    Total    int64 `json:"totalMs"`    // Total duration in ms (start->end of body)
 }
 
-
+// TLSInfo summarizes the upstream TLS connection of a transaction.
+type TLSInfo struct {
+    Version      string    `json:"version"`
+    CipherSuite  string    `json:"cipherSuite"`
+    ALPN         string    `json:"alpn,omitempty"`
+    ServerName   string    `json:"serverName,omitempty"`
+    PeerSubject  string    `json:"peerSubject,omitempty"`
+    PeerIssuer   string    `json:"peerIssuer,omitempty"`
+    PeerNotAfter time.Time `json:"peerNotAfter"`
+}
@@ -25,6 +25,59 @@ type Session struct {
 	Frames     FrameCounters `json:"frames"`
 	Events     EventCounters `json:"events"`
 	Evicted    bool          `json:"evicted"`
-	Kind       string        `json:"kind"` // "ws" | "http"
+	Kind       string        `json:"kind"` // "ws" | "http" | "tunnel"
 	CaptureID  *int          `json:"captureId,omitempty"`
+	// ReplayOf references the session this one was replayed from (debugger-issued requests).
+	ReplayOf string `json:"replayOf,omitempty"`
+	// ServerIP is the remote IP actually dialed for the upstream (after DNS overrides; the proxy IP when chained).
+	ServerIP string `json:"serverIp,omitempty"`
+	// ClientCert records the mutual TLS exchange with the upstream (nil when the server did not ask
+	// and no certificate was configured).
+	ClientCert *ClientCertUsage `json:"clientCert,omitempty"`
+	// ChainID groups the hops of a redirect chain (id of the first hop); RedirectFrom is the previous hop.
+	ChainID      string `json:"chainId,omitempty"`
+	RedirectFrom string `json:"redirectFrom,omitempty"`
+	// Via tells how the exchange entered the proxy: "reverse", "forward", "mitm", "socks" or "transparent".
+	// TunnelID groups the exchanges carried by one intercepted CONNECT tunnel.
+	Via      string `json:"via,omitempty"`
+	TunnelID string `json:"tunnelId,omitempty"`
+	// ClientID identifies the device the session came from (see /_api/v1/clients).
+	ClientID string `json:"clientId,omitempty"`
+	// User is the account that authenticated the proxy request (PROXY_USERS, SOCKS auth).
+	User string `json:"user,omitempty"`
+	// Tunnel describes an opaque (not intercepted) CONNECT tunnel.
+	Tunnel *TunnelInfo `json:"tunnel,omitempty"`
+}
+
+// TunnelInfo is what the proxy can see of a CONNECT tunnel it relays without decrypting.
+type TunnelInfo struct {
+	// TLS is set when the client opened with a TLS ClientHello; SNI and ALPN are taken from it.
+	TLS  bool     `json:"tls"`
+	SNI  string   `json:"sni,omitempty"`
+	ALPN []string `json:"alpn,omitempty"`
+	// BytesUp counts client -> upstream bytes, BytesDown upstream -> client.
+	BytesUp   int64 `json:"bytesUp"`
+	BytesDown int64 `json:"bytesDown"`
+	// DialMs is the upstream connect time, DurationMs the tunnel lifetime.
+	DialMs     int64 `json:"dialMs"`
+	DurationMs int64 `json:"durationMs"`
+	// MITMSkipped tells why the tunnel was not intercepted: "disabled", "no_ca", "denied" (by a
+	// rule or MITM_DOMAINS_*), "pinned" (learned passthrough), "client" (the client's mitm setting)
+	// or "not_tls" (SOCKS client that did not open with a ClientHello); MITMRule is the deciding
+	// rule id.
+	MITMSkipped string `json:"mitmSkipped,omitempty"`
+	MITMRule    string `json:"mitmRule,omitempty"`
+	// PassthroughLearned marks the failed interception that put the host on the passthrough list
+	// (the client refused the MITM certificate, e.g. certificate pinning).
+	PassthroughLearned bool `json:"passthroughLearned,omitempty"`
+}
+
+// ClientCertUsage describes the client certificate exchange of an upstream TLS handshake.
+type ClientCertUsage struct {
+	// Requested: the server sent a CertificateRequest
+	Requested bool `json:"requested"`
+	// CertID / Subject / Fingerprint identify the presented certificate (empty when none was sent)
+	CertID      string `json:"certId,omitempty"`
+	Subject     string `json:"subject,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// bodySpool stores a copy of a body in a temp file while the original bytes keep flowing to the
+// peer. Only the stored copy is capped (BODY_MAX_BYTES); the traffic itself is never cut.
+type bodySpool struct {
+	mu        sync.Mutex
+	f         *os.File
+	path      string
+	max       int64
+	stored    int64
+	total     int64
+	truncated bool
+	closed    bool
+}
+
+// newBodySpool creates the spool file in BodySpoolDir (os.TempDir() when empty).
+func (d *Deps) newBodySpool(kind string) (*bodySpool, error) {
+	dir := d.Cfg.BodySpoolDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "gpx-"+kind+"-*.bin")
+	if err != nil {
+		return nil, err
+	}
+	abs, _ := filepath.Abs(f.Name())
+	max := int64(d.Cfg.BodyMaxBytes)
+	if max <= 0 {
+		max = 8 << 20
+	}
+	return &bodySpool{f: f, path: abs, max: max}, nil
+}
+
+// Write stores what fits under the cap and always reports success, so a tee never fails the
+// data path because of the capture.
+func (s *bodySpool) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total += int64(len(p))
+	if s.closed {
+		return len(p), nil
+	}
+	chunk := p
+	if room := s.max - s.stored; int64(len(chunk)) > room {
+		chunk = chunk[:room]
+		s.truncated = true
+	}
+	if len(chunk) > 0 {
+		n, _ := s.f.Write(chunk)
+		s.stored += int64(n)
+	}
+	return len(p), nil
+}
+
+// finish closes the file (idempotent) and reports its path, whether the stored copy was cut and
+// how many bytes passed through.
+func (s *bodySpool) finish() (path string, truncated bool, total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		_ = s.f.Close()
+	}
+	return s.path, s.truncated, s.total
+}
+
+// discard closes and removes the spool file (exchange was not recorded).
+func (s *bodySpool) discard() {
+	path, _, _ := s.finish()
+	_ = os.Remove(path)
+}
+
+// teeBody copies everything read from rc into s; the spool is finished on EOF/error or Close.
+func teeBody(rc io.ReadCloser, s *bodySpool) io.ReadCloser {
+	return &teeReadCloser{rc: rc, s: s}
+}
+
+type teeReadCloser struct {
+	rc io.ReadCloser
+	s  *bodySpool
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.rc.Read(p)
+	if n > 0 {
+		_, _ = t.s.Write(p[:n])
+	}
+	if err != nil {
+		t.s.finish()
+	}
+	return n, err
+}
+
+func (t *teeReadCloser) Close() error {
+	t.s.finish()
+	return t.rc.Close()
+}
+
+// spoolBody stores r (already in memory / fully readable) via a bodySpool and returns the file
+// path and whether the stored copy was truncated.
+func (d *Deps) spoolBody(r io.Reader, kind string) (string, bool, error) {
+	s, err := d.newBodySpool(kind)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := io.Copy(s, r); err != nil {
+		s.discard()
+		return "", false, err
+	}
+	path, truncated, _ := s.finish()
+	return path, truncated, nil
+}
@@ -0,0 +1,199 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CAStore keeps the MITM CA across restarts (MITM_CA_DIR) and tracks a pending rotation: the
+// next CA is published for installation right away but only starts issuing leaf certificates
+// at activateAt, so devices that trust the current CA keep working during the grace period.
+// With an empty dir the store is memory-only.
+type CAStore struct {
+	dir        string
+	mu         sync.Mutex
+	next       *CertAuthority
+	activateAt time.Time
+	timer      *time.Timer
+}
+
+// Files inside the CA directory; keys are written 0600 and the directory 0700.
+const (
+	caCertFile     = "ca.pem"
+	caKeyFile      = "ca-key.pem"
+	caNextCertFile = "next.pem"
+	caNextKeyFile  = "next-key.pem"
+	caRotationFile = "rotation.json"
+)
+
+func NewCAStore(dir string) *CAStore {
+	return &CAStore{dir: dir}
+}
+
+// Persistent reports whether the CA is written to disk.
+func (s *CAStore) Persistent() bool { return s != nil && s.dir != "" }
+
+// Load reads the stored CA (nil when none was saved yet) and any pending rotation.
+func (s *CAStore) Load() (*CertAuthority, error) {
+	if !s.Persistent() {
+		return nil, nil
+	}
+	ca, err := s.readCA(caCertFile, caKeyFile)
+	if err != nil || ca == nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(filepath.Join(s.dir, caRotationFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return ca, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rot struct {
+		ActivateAt time.Time `json:"activateAt"`
+	}
+	if err := json.Unmarshal(raw, &rot); err != nil {
+		return nil, errors.New("mitm: invalid " + caRotationFile + ": " + err.Error())
+	}
+	next, err := s.readCA(caNextCertFile, caNextKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if next != nil {
+		s.mu.Lock()
+		s.next, s.activateAt = next, rot.ActivateAt
+		s.mu.Unlock()
+	}
+	return ca, nil
+}
+
+func (s *CAStore) readCA(certName, keyName string) (*CertAuthority, error) {
+	certPEM, err := os.ReadFile(filepath.Join(s.dir, certName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(s.dir, keyName))
+	if err != nil {
+		return nil, err
+	}
+	return LoadCertAuthorityFromPEM(certPEM, keyPEM)
+}
+
+// Save stores ca as the current CA and drops any pending rotation.
+func (s *CAStore) Save(ca *CertAuthority) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearPendingLocked()
+	if !s.Persistent() {
+		return nil
+	}
+	if err := s.writeCA(ca, caCertFile, caKeyFile); err != nil {
+		return err
+	}
+	for _, name := range []string{caRotationFile, caNextCertFile, caNextKeyFile} {
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPending stores next as the CA taking over at activateAt.
+func (s *CAStore) SetPending(next *CertAuthority, activateAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Persistent() {
+		if err := s.writeCA(next, caNextCertFile, caNextKeyFile); err != nil {
+			return err
+		}
+		raw, _ := json.Marshal(map[string]time.Time{"activateAt": activateAt.UTC()})
+		if err := writeFileAtomic(filepath.Join(s.dir, caRotationFile), raw, 0o600); err != nil {
+			return err
+		}
+	}
+	s.clearPendingLocked()
+	s.next, s.activateAt = next, activateAt
+	return nil
+}
+
+// Pending returns the CA waiting for activation and when it takes over (nil when none).
+func (s *CAStore) Pending() (*CertAuthority, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next, s.activateAt
+}
+
+// Promote makes the pending CA current and returns it (nil when nothing is pending).
+func (s *CAStore) Promote() (*CertAuthority, error) {
+	next, _ := s.Pending()
+	if next == nil {
+		return nil, nil
+	}
+	if err := s.Save(next); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// schedule calls fn when the pending CA is due (immediately when already due).
+func (s *CAStore) schedule(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == nil {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(time.Until(s.activateAt), fn)
+}
+
+func (s *CAStore) clearPendingLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.next, s.activateAt = nil, time.Time{}
+}
+
+func (s *CAStore) writeCA(ca *CertAuthority, certName, keyName string) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	keyPEM, err := ca.KeyPEM()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, keyName), keyPEM, 0o600); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, certName), ca.CertPEM(), 0o644)
+}
+
+// writeFileAtomic writes through a temp file so a crash never leaves a half-written key.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
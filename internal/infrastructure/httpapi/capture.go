@@ -0,0 +1,400 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// exchange describes how one HTTP request entered the proxy; captureHTTP does the rest.
+type exchange struct {
+	// upstream is the absolute URL the request is sent to
+	upstream *url.URL
+	// host overrides the Host header (default: upstream host)
+	host string
+	// via: "reverse" (/httpproxy, /proxy), "forward" (absolute-URI requests), "mitm" (CONNECT interception),
+	// "socks" (plain HTTP and opaque tunnels through the SOCKS5 listener), "transparent" (SNI-routed TLS listener)
+	via string
+	// tunnelID / streamID identify the MITM tunnel and the client's h2 stream
+	tunnelID string
+	streamID uint32
+	// forwardedProto is the scheme reported in X-Forwarded-Proto (default: from r.TLS)
+	forwardedProto string
+	// clientID is the client the tunnel or connection was attributed to (default: identified
+	// from the request)
+	clientID string
+	// issued is the session of a request the debugger sends itself (composer, replay): its id,
+	// attribution and replay/redirect links are kept, and no forwarding headers, response delay,
+	// throttling or client redirect tracking apply
+	issued *domain.Session
+	// transport overrides the shared pool (composer: forced HTTP version)
+	transport http.RoundTripper
+}
+
+// captureResult is what captureHTTP recorded: the final transaction (Status 0 when the exchange
+// failed before a response arrived) and the transport or response body error.
+type captureResult struct {
+	sessionID string
+	tx        domain.HTTPTransaction
+	err       error
+}
+
+// captureHTTP is the capture pipeline shared by the reverse, forward, MITM and debugger-issued
+// paths: it records a session with preview frames and a transaction (timings, bodies, TLS info,
+// error classification), applies the response delay and relays the exchange through the shared
+// transport pool.
+func (d *Deps) captureHTTP(w http.ResponseWriter, r *http.Request, ex exchange) captureResult {
+	upstream := *ex.upstream
+	sessionID := id.New()
+	clientID := ex.clientID
+	if ex.issued != nil {
+		sessionID, clientID = ex.issued.ID, ex.issued.ClientID
+	} else if clientID == "" {
+		clientID = d.Clients.identify(d.clientOfRequest(r))
+	}
+	sess := domain.Session{
+		ID:         sessionID,
+		Target:     upstream.String(),
+		ClientAddr: clientHost(r.RemoteAddr),
+		StartedAt:  time.Now().UTC(),
+		Kind:       "http",
+		Via:        ex.via,
+		TunnelID:   ex.tunnelID,
+		User:       proxyUser(r.Context()),
+		ClientID:   clientID,
+	}
+	if ex.issued != nil {
+		sess.ClientAddr, sess.User = ex.issued.ClientAddr, ex.issued.User
+		sess.ReplayOf, sess.ChainID, sess.RedirectFrom = ex.issued.ReplayOf, ex.issued.ChainID, ex.issued.RedirectFrom
+	} else {
+		// client following a redirect we just relayed: link the hop into its chain
+		d.linkRedirect(&sess, &upstream)
+	}
+	if err := d.Svc.Create(r.Context(), sess); err != nil {
+		writeError(w, http.StatusInternalServerError, "SESSION_CREATE_FAILED", err.Error(), nil)
+		return captureResult{err: err}
+	}
+	d.Monitor.Broadcast(MonitorEvent{Type: "session_started", ID: sessionID})
+	d.Metrics.ActiveSessions.Inc()
+
+	host := ex.host
+	if host == "" {
+		host = upstream.Host
+	}
+	// Create reverse proxy
+	director := func(req *http.Request) {
+		req.URL = &upstream
+		req.Host = host
+		// Clean hop-by-hop headers; httputil will remove most, but ensure here for clarity
+		removeHopHeaders(req.Header)
+		req.Header.Del(clientIDHeader)
+		if ex.issued != nil {
+			// nil keeps ReverseProxy from adding X-Forwarded-For
+			req.Header["X-Forwarded-For"] = nil
+		}
+	}
+	throttle, throttled := throttleProfiles[d.Clients.settings(clientID).Throttle]
+	throttled = throttled && ex.issued == nil
+	clientProto := ""
+	if ex.issued == nil {
+		clientProto = clientProtocolName(r)
+	}
+
+	// shared pool: keep-alive connections are reused across sessions
+	var transport http.RoundTripper = d.Transports
+	if ex.transport != nil {
+		transport = ex.transport
+	}
+	// timings via httptrace
+	timer := newHTTPTimer()
+	// CAPTURE_BODIES: tee both bodies into capped spool files while they stream to the peer
+	var reqSpool, respSpool *bodySpool
+	// reqBody counts the request bytes relayed upstream (sizes of bodies without Content-Length)
+	var reqBody *countedBody
+	hadError := false
+	// recorded summary; timings are finalized once the body has been streamed to the client
+	var recorded *domain.HTTPTransaction
+	res := captureResult{sessionID: sessionID}
+	newTx := func() domain.HTTPTransaction {
+		tx := domain.HTTPTransaction{
+			ID: id.New(), SessionID: sessionID, Method: r.Method, URL: strings.TrimSuffix(upstream.String(), "?"),
+			ReqSize:        int64ToInt(r.ContentLength),
+			StartedAt:      timer.start,
+			ClientProtocol: clientProto,
+			StreamID:       ex.streamID,
+		}
+		if reqBody != nil && r.ContentLength < 0 {
+			tx.ReqSize = reqBody.size()
+		}
+		return tx
+	}
+	var proxy *httputil.ReverseProxy
+	proxy = &httputil.ReverseProxy{
+		Director:  director,
+		Transport: transport,
+		// periodic flushing for regular bodies; streaming responses flush every write (see below)
+		FlushInterval: 100 * time.Millisecond,
+		ModifyResponse: func(resp *http.Response) error {
+			// Artificial response delay (to visualize timeline)
+			if ex.issued == nil {
+				sleepResponseDelay(d.Cfg)
+			}
+			if throttled {
+				time.Sleep(throttle.latency)
+				resp.Body = newThrottledBody(resp.Body, throttle.downKbps)
+			}
+			// Track body completion for the receive phase
+			resp.Body = timer.trackBody(resp.Body)
+			// SSE / NDJSON: no write deadline, immediate flush, per-event capture.
+			// ReverseProxy reads FlushInterval after ModifyResponse returns.
+			if d.prepareStreamingResponse(w, resp, sessionID) {
+				proxy.FlushInterval = -1
+			}
+			// Log response frame with timings embedded
+			basePreview := buildHTTPResponsePreview(resp)
+			ttfb := durationMs(timer.start, timer.firstByte())
+			total := durationMs(timer.start, time.Now())
+			preview := augmentPreviewWithTimings(basePreview, ttfb, total)
+			fr := domain.Frame{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionUpstreamToClient, Opcode: domain.OpcodeText, Size: int(resp.ContentLength), Preview: preview}
+			_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
+			d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
+			d.Metrics.FramesTotal.WithLabelValues(string(domain.DirectionUpstreamToClient), string(domain.OpcodeText)).Inc()
+
+			// Persist HTTP transaction summary
+			tx := newTx()
+			tx.Status = resp.StatusCode
+			tx.RespSize = int(resp.ContentLength)
+			tx.EndedAt = time.Now().UTC()
+			tx.Timings = timer.timings(time.Now())
+			tx.ServerIPAddress = timer.serverIP()
+			tx.Protocol = protocolName(resp)
+			tx.TLS = tlsInfoOf(resp)
+			tx.ConnID, tx.ConnReused = timer.conn()
+			if ex.issued == nil {
+				d.noteRedirect(sessionID, sess.ClientAddr, &upstream, resp.StatusCode, resp.Header)
+			}
+			d.recordServerIP(sessionID, tx.ServerIPAddress)
+			d.recordClientCert(sessionID, timer.clientCert())
+			if resp.Request != nil {
+				tx.ReqHeaders = cloneHeader(resp.Request.Header)
+			}
+			// Best-effort content-type
+			if ct := resp.Header.Get("Content-Type"); ct != "" {
+				tx.ContentType = ct
+			}
+			if reqSpool != nil {
+				// request body has been relayed by now; truncation is settled in finalizeHTTPTransaction
+				tx.ReqBodyFile = reqSpool.path
+			}
+			// Optional body spooling: the file is complete once the body was relayed (see finalizeHTTPTransaction)
+			if d.Cfg.CaptureBodies && resp.Body != nil && resp.Body != http.NoBody {
+				if sp, err := d.newBodySpool("resp"); err == nil {
+					respSpool = sp
+					resp.Body = teeBody(resp.Body, sp)
+				}
+			}
+			_ = d.Svc.AddHTTPTransaction(contextWithNoCancel(), tx)
+			d.Monitor.Broadcast(MonitorEvent{Type: "http_tx_added", ID: sessionID, Ref: tx.ID})
+			recorded = &tx
+			return nil
+		},
+		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
+			hadError = true
+			res.err = err
+			_ = d.Svc.SetClosed(contextWithNoCancel(), sessionID, time.Now().UTC(), strPtr(err.Error()))
+			d.recordTLSFailure(sessionID, err)
+
+			// Get human-readable error message and code
+			errorCode, errorMessage := humanizeProxyError(err)
+
+			// failed exchanges keep a transaction too (no status, classified error)
+			if recorded == nil {
+				tx := newTx()
+				tx.EndedAt = time.Now().UTC()
+				tx.Timings = timer.timings(time.Now())
+				tx.ServerIPAddress = timer.serverIP()
+				tx.ConnID, tx.ConnReused = timer.conn()
+				tx.ReqHeaders = cloneHeader(req.Header)
+				tx.Error, tx.ErrorCode = err.Error(), errorCode
+				_ = d.Svc.AddHTTPTransaction(contextWithNoCancel(), tx)
+				d.Monitor.Broadcast(MonitorEvent{Type: "http_tx_added", ID: sessionID, Ref: tx.ID})
+				res.tx = tx
+			}
+
+			// Enhanced logging with context
+			d.Logger.Error().
+				Err(err).
+				Str("sessionID", sessionID).
+				Str("target", upstream.String()).
+				Str("method", r.Method).
+				Str("clientAddr", clientHost(r.RemoteAddr)).
+				Str("errorCode", errorCode).
+				Msg(errorMessage)
+
+			// Broadcast error to frontend with user-friendly message
+			d.Monitor.Broadcast(MonitorEvent{
+				Type: "session_error",
+				ID:   sessionID,
+				Error: &ErrorDetails{
+					Code:    errorCode,
+					Message: errorMessage,
+					Raw:     err.Error(),
+					Target:  upstream.String(),
+					Method:  r.Method,
+				},
+			})
+			writeError(rw, http.StatusBadGateway, errorCode, errorMessage, map[string]any{"target": upstream.String(), "raw": err.Error()})
+		},
+	}
+	if ex.issued != nil {
+		// body errors end up in captureResult.err; ReverseProxy would only log them
+		proxy.ErrorLog = log.New(io.Discard, "", 0)
+	}
+
+	// Emit lightweight session-start heartbeat frame so UI can draw in-progress bar immediately.
+	{
+		hb := map[string]any{"type": "http_progress", "phase": "started"}
+		b, _ := json.Marshal(hb)
+		fr := domain.Frame{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionClientToUpstream, Opcode: domain.OpcodeText, Size: len(b), Preview: string(b)}
+		_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
+		d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
+	}
+
+	// Safely peek a small portion of request body and keep stream intact for upstream.
+	var reqBodyBuf []byte
+	if r.Body != nil {
+		peekSize := previewMaxBytes
+		if peekSize <= 0 {
+			peekSize = 65536
+		}
+		if peekSize > 65536 {
+			peekSize = 65536
+		}
+		peek := make([]byte, peekSize)
+		n, _ := io.ReadFull(r.Body, peek)
+		if n > 0 {
+			reqBodyBuf = peek[:n]
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBodyBuf), r.Body))
+		}
+	}
+	// Optional request body spooling (tee: upstream still receives the full body)
+	if d.Cfg.CaptureBodies && r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		if sp, err := d.newBodySpool("req"); err == nil {
+			reqSpool = sp
+			r.Body = teeBody(r.Body, sp)
+		}
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		reqBody = &countedBody{ReadCloser: r.Body}
+		r.Body = reqBody
+	}
+	// For preview, show the real upstream URL (not the /httpproxy path)
+	rPrev := *r
+	rPrev.URL = &upstream
+	reqPreview := buildHTTPRequestPreview(&rPrev, reqBodyBuf)
+	fr := domain.Frame{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionClientToUpstream, Opcode: domain.OpcodeText, Size: int64ToInt(r.ContentLength), Preview: reqPreview}
+	_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
+	d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
+	d.Metrics.FramesTotal.WithLabelValues(string(domain.DirectionClientToUpstream), string(domain.OpcodeText)).Inc()
+
+	// Attach httptrace to catch milestones (write times atomically; parallel dial may trigger concurrently)
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), timer.clientTrace()))
+
+	// Standard forwarding headers (useful for logs/upstream)
+	if ex.issued == nil {
+		if ip := clientHost(r.RemoteAddr); ip != "" {
+			r.Header.Set("X-Forwarded-For", ip)
+		}
+		proto := ex.forwardedProto
+		if proto == "" {
+			proto = "http"
+			if r.TLS != nil {
+				proto = "https"
+			}
+		}
+		r.Header.Set("X-Forwarded-Proto", proto)
+		r.Header.Set("Via", "network-debugger")
+	}
+
+	// Serve
+	proxy.ServeHTTP(w, r)
+	if recorded != nil {
+		if reqBody != nil && r.ContentLength < 0 {
+			// the body may still have been streaming when the response arrived
+			recorded.ReqSize = reqBody.size()
+		}
+		res.tx = d.finalizeHTTPTransaction(*recorded, timer, reqSpool, respSpool)
+	} else if reqSpool != nil {
+		reqSpool.discard()
+	}
+	if !hadError {
+		var closeErr *string
+		if res.err = timer.bodyError(); res.err != nil {
+			closeErr = strPtr(res.err.Error())
+		}
+		_ = d.Svc.SetClosed(contextWithNoCancel(), sessionID, time.Now().UTC(), closeErr)
+	}
+	d.Monitor.Broadcast(MonitorEvent{Type: "session_ended", ID: sessionID})
+	d.Metrics.ActiveSessions.Dec()
+	return res
+}
+
+// countedBody counts the bytes read from a request body; the transport may read it from its
+// own goroutine, so the counter is atomic.
+type countedBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	return n, err
+}
+
+func (b *countedBody) size() int { return int64ToInt(atomic.LoadInt64(&b.n)) }
+
+// issuedContext hides the API server from ReverseProxy, so a failing upstream body ends a
+// debugger-issued exchange with an error instead of aborting the API handler.
+type issuedContext struct{ context.Context }
+
+func (c issuedContext) Value(key any) any {
+	if key == http.ServerContextKey {
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+// clientProtocolName labels the protocol the client used for r ("http/1.1", "h2").
+func clientProtocolName(r *http.Request) string {
+	if r.ProtoMajor == 2 {
+		return "h2"
+	}
+	return strings.ToLower(r.Proto)
+}
+
+// tlsInfoOf summarizes the upstream TLS connection of resp (nil for plain http).
+func tlsInfoOf(resp *http.Response) *domain.TLSInfo {
+	if resp == nil || resp.TLS == nil {
+		return nil
+	}
+	cs := resp.TLS
+	info := &domain.TLSInfo{Version: tlsVersionString(cs.Version), CipherSuite: cipherSuiteString(cs.CipherSuite), ALPN: cs.NegotiatedProtocol, ServerName: cs.ServerName}
+	if len(cs.PeerCertificates) > 0 {
+		leaf := cs.PeerCertificates[0]
+		info.PeerSubject, info.PeerIssuer, info.PeerNotAfter = leaf.Subject.String(), leaf.Issuer.String(), leaf.NotAfter.UTC()
+	}
+	return info
+}
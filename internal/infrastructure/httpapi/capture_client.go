@@ -0,0 +1,173 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// issueOptions tune how a debugger-issued request is sent upstream.
+type issueOptions struct {
+	// HTTPVersion forces the protocol: "1.1", "2" or empty to negotiate.
+	HTTPVersion string
+	// FollowRedirects makes issueFollowingRedirects chase Location headers (each hop is its own session).
+	FollowRedirects bool
+	// MaxRedirects bounds the number of followed hops (default 10).
+	MaxRedirects int
+}
+
+// capturedResponse is the outcome of a request issued by the debugger itself (replay, composer).
+type capturedResponse struct {
+	SessionID string
+	Status    int
+	Header    http.Header
+	Body      []byte
+	// Truncated reports that Body was cut at BodyMaxBytes.
+	Truncated bool
+	Tx        domain.HTTPTransaction
+}
+
+// issueCaptured sends req upstream on behalf of the debugger through captureHTTP, so the exchange
+// is recorded like proxied traffic. sess must carry ID/Target/ClientAddr plus the attribution and
+// links to keep; the response is received in process (body kept up to BodyMaxBytes).
+// On transport or body errors the session is closed with the error and the error is returned
+// together with a partially filled result (SessionID is always set).
+func (d *Deps) issueCaptured(ctx context.Context, sess domain.Session, req *http.Request, body []byte, opts issueOptions) (*capturedResponse, error) {
+	out := &capturedResponse{SessionID: sess.ID}
+	transport, err := d.Transports.WithHTTPVersion(opts.HTTPVersion)
+	if err != nil {
+		return out, err
+	}
+	limit := d.Cfg.BodyMaxBytes
+	if limit <= 0 {
+		limit = 8 << 20
+	}
+	rec := &issuedResponse{header: http.Header{}, limit: limit}
+	in := req.Clone(issuedContext{ctx})
+	in.RemoteAddr = sess.ClientAddr
+	in.Body, in.ContentLength = http.NoBody, 0
+	if len(body) > 0 {
+		in.Body, in.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+	}
+	res := d.captureHTTP(rec, in, exchange{upstream: req.URL, host: req.Host, issued: &sess, transport: transport})
+	out.Tx = res.tx
+	if res.tx.Status == 0 {
+		// no response: rec only holds captureHTTP's own error reply
+		return out, res.err
+	}
+	out.Status, out.Header, out.Body, out.Truncated = res.tx.Status, rec.header, rec.body.Bytes(), rec.truncated
+	return out, res.err
+}
+
+// issuedResponse receives the response of a debugger-issued exchange in process: status, headers
+// and the body up to limit (the rest is read and dropped so the upstream connection can be reused).
+type issuedResponse struct {
+	header    http.Header
+	status    int
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *issuedResponse) Header() http.Header { return w.header }
+
+func (w *issuedResponse) WriteHeader(code int) {
+	// 1xx responses are relayed before the final one
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+}
+
+func (w *issuedResponse) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if room := w.limit - w.body.Len(); room < len(p) {
+		w.truncated = true
+		if room > 0 {
+			w.body.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	w.body.Write(p)
+	return len(p), nil
+}
+
+func (w *issuedResponse) Flush() {}
+
+// issueFollowingRedirects issues req via issueCaptured and, when opts.FollowRedirects is set,
+// follows 3xx responses with a Location header. Every hop is recorded as a separate session
+// linked by ChainID (id of the first hop) and RedirectFrom;
+// the returned slice lists all hops in order (the last one is the final response).
+// Method/body rewriting mirrors net/http.Client: 301/302/303 switch to GET without body
+// (except HEAD), 307/308 preserve both. Credentials are dropped when the host changes.
+func (d *Deps) issueFollowingRedirects(ctx context.Context, sess domain.Session, req *http.Request, body []byte, opts issueOptions) ([]*capturedResponse, error) {
+	maxHops := opts.MaxRedirects
+	if maxHops <= 0 {
+		maxHops = 10
+	}
+	hops := make([]*capturedResponse, 0, 1)
+	for {
+		res, err := d.issueCaptured(ctx, sess, req, body, opts)
+		hops = append(hops, res)
+		if err != nil || !opts.FollowRedirects {
+			return hops, err
+		}
+		next, nextBody, ok := redirectRequest(ctx, req, body, res)
+		if !ok {
+			return hops, nil
+		}
+		if len(hops) > maxHops {
+			return hops, fmt.Errorf("stopped after %d redirects", maxHops)
+		}
+		chain := sess.ChainID
+		if chain == "" {
+			chain = sess.ID
+			d.setChainID(sess.ID, chain)
+		}
+		sess = domain.Session{ID: id.New(), Target: next.URL.String(), ClientAddr: sess.ClientAddr, ClientID: sess.ClientID, User: sess.User, ReplayOf: sess.ReplayOf, ChainID: chain, RedirectFrom: sess.ID}
+		req, body = next, nextBody
+	}
+}
+
+// redirectRequest builds the follow-up request for a redirect response; ok=false when res is not a redirect.
+func redirectRequest(ctx context.Context, prev *http.Request, body []byte, res *capturedResponse) (*http.Request, []byte, bool) {
+	switch res.Status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, nil, false
+	}
+	loc := res.Header.Get("Location")
+	if loc == "" {
+		return nil, nil, false
+	}
+	u, err := prev.URL.Parse(loc)
+	if err != nil {
+		return nil, nil, false
+	}
+	method := prev.Method
+	if res.Status != http.StatusTemporaryRedirect && res.Status != http.StatusPermanentRedirect {
+		if method != http.MethodHead {
+			method = http.MethodGet
+		}
+		body = nil
+	}
+	next, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, false
+	}
+	next.Header = prev.Header.Clone()
+	if len(body) == 0 {
+		next.Body = http.NoBody
+		next.Header.Del("Content-Type")
+	}
+	next.ContentLength = int64(len(body))
+	if u.Host != prev.URL.Host {
+		next.Header.Del("Authorization")
+		next.Header.Del("Cookie")
+	}
+	return next, body, true
+}
@@ -0,0 +1,280 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// ClientCert is a client certificate presented to matching upstream hosts (mutual TLS).
+type ClientCert struct {
+	ID       string
+	Patterns []string
+	Cert     tls.Certificate
+	// Subject / Fingerprint (SHA-256 of the leaf, hex) / NotAfter describe the leaf for the UI
+	Subject     string
+	Fingerprint string
+	NotAfter    time.Time
+}
+
+// ClientCertStore keeps the configured client certificates; the first entry whose patterns match
+// the upstream host is presented when the server asks for a certificate.
+type ClientCertStore struct {
+	mu    sync.RWMutex
+	certs []*ClientCert
+}
+
+func NewClientCertStore(certs []*ClientCert) *ClientCertStore {
+	return &ClientCertStore{certs: certs}
+}
+
+// NewClientCertFromPEM builds an entry from PEM cert (chain) and key blocks.
+func NewClientCertFromPEM(patterns []string, certPEM, keyPEM []byte) (*ClientCert, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, errors.New("client cert: " + err.Error())
+	}
+	return newClientCert(patterns, cert)
+}
+
+// NewClientCertFromPKCS12 builds an entry from a PKCS#12 (.p12/.pfx) bundle.
+func NewClientCertFromPKCS12(patterns []string, data []byte, password string) (*ClientCert, error) {
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, errors.New("client cert: " + err.Error())
+	}
+	cert := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return newClientCert(patterns, cert)
+}
+
+func newClientCert(patterns []string, cert tls.Certificate) (*ClientCert, error) {
+	var pats []string
+	for _, p := range patterns {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			pats = append(pats, p)
+		}
+	}
+	if len(pats) == 0 {
+		return nil, errors.New("client cert: no host patterns")
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("client cert: empty certificate")
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, errors.New("client cert: " + err.Error())
+		}
+		cert.Leaf = leaf
+	}
+	sum := sha256.Sum256(leaf.Raw)
+	return &ClientCert{ID: id.New(), Patterns: pats, Cert: cert, Subject: leaf.Subject.String(), Fingerprint: hex.EncodeToString(sum[:]), NotAfter: leaf.NotAfter}, nil
+}
+
+// LoadClientCerts parses UPSTREAM_CLIENT_CERTS: "patterns=cert.pem,key.pem;patterns=client.p12,password".
+// A single PEM file may hold both the certificate and the key; .p12/.pfx files are PKCS#12.
+func LoadClientCerts(spec string) ([]*ClientCert, error) {
+	var out []*ClientCert
+	var errs []string
+	for _, rule := range strings.Split(spec, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		lhs, rhs, ok := strings.Cut(rule, "=")
+		if !ok {
+			errs = append(errs, "client cert without '=': "+rule)
+			continue
+		}
+		file, arg, _ := strings.Cut(strings.TrimSpace(rhs), ",")
+		file, arg = strings.TrimSpace(file), strings.TrimSpace(arg)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		var c *ClientCert
+		switch ext := strings.ToLower(file); {
+		case strings.HasSuffix(ext, ".p12") || strings.HasSuffix(ext, ".pfx"):
+			c, err = NewClientCertFromPKCS12(strings.Split(lhs, ","), data, arg)
+		case arg == "":
+			c, err = NewClientCertFromPEM(strings.Split(lhs, ","), data, data)
+		default:
+			var key []byte
+			if key, err = os.ReadFile(arg); err == nil {
+				c, err = NewClientCertFromPEM(strings.Split(lhs, ","), data, key)
+			}
+		}
+		if err != nil {
+			errs = append(errs, file+": "+err.Error())
+			continue
+		}
+		out = append(out, c)
+	}
+	if len(errs) > 0 {
+		return out, errors.New("client certs: " + strings.Join(errs, "; "))
+	}
+	return out, nil
+}
+
+func (s *ClientCertStore) Add(c *ClientCert) {
+	s.mu.Lock()
+	s.certs = append(s.certs, c)
+	s.mu.Unlock()
+}
+
+// Remove deletes the entry by id; reports whether it existed.
+func (s *ClientCertStore) Remove(certID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.certs {
+		if c.ID == certID {
+			s.certs = append(s.certs[:i:i], s.certs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ClientCertStore) List() []*ClientCert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*ClientCert(nil), s.certs...)
+}
+
+// Match returns the certificate for host (without port), or nil.
+func (s *ClientCertStore) Match(host string) *ClientCert {
+	if s == nil {
+		return nil
+	}
+	host = strings.ToLower(host)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.certs {
+		for _, p := range c.Patterns {
+			if matchUpstreamPattern(p, host) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// clientCertHook returns a GetClientCertificate callback for host that records into usage whether
+// the server requested a certificate and which one was presented.
+func (s *ClientCertStore) clientCertHook(host string, usage *domain.ClientCertUsage, mu *sync.Mutex) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		c := s.Match(host)
+		mu.Lock()
+		defer mu.Unlock()
+		usage.Requested = true
+		if c == nil {
+			// no configured identity: continue without a certificate, the server decides
+			return &tls.Certificate{}, nil
+		}
+		usage.CertID, usage.Subject, usage.Fingerprint = c.ID, c.Subject, c.Fingerprint
+		return &c.Cert, nil
+	}
+}
+
+// recordClientCert stores the mTLS exchange on the session (first handshake wins).
+func (d *Deps) recordClientCert(sessionID string, usage *domain.ClientCertUsage) {
+	if usage == nil || (!usage.Requested && usage.CertID == "") {
+		return
+	}
+	_ = d.Svc.UpdateSession(contextWithNoCancel(), sessionID, func(s *domain.Session) {
+		if s.ClientCert == nil {
+			u := *usage
+			s.ClientCert = &u
+		}
+	})
+}
+
+type clientCertDTO struct {
+	ID          string    `json:"id"`
+	Patterns    []string  `json:"patterns"`
+	Subject     string    `json:"subject"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"notAfter"`
+}
+
+type clientCertInput struct {
+	Patterns []string `json:"patterns"`
+	CertPEM  string   `json:"certPem"`
+	KeyPEM   string   `json:"keyPem"`
+	// PKCS12 is the base64-encoded .p12/.pfx bundle (alternative to certPem/keyPem)
+	PKCS12   string `json:"pkcs12"`
+	Password string `json:"password"`
+}
+
+// handleV1ClientCerts manages upstream client certificates:
+// GET lists them (no key material), POST adds one (PEM pair or base64 PKCS#12), DELETE ?id=… removes one.
+func (d *Deps) handleV1ClientCerts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var in clientCertInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+			return
+		}
+		var c *ClientCert
+		var err error
+		if in.PKCS12 != "" {
+			data, derr := base64.StdEncoding.DecodeString(in.PKCS12)
+			if derr != nil {
+				writeError(w, http.StatusBadRequest, "BAD_VALUE", "pkcs12 must be base64", nil)
+				return
+			}
+			c, err = NewClientCertFromPKCS12(in.Patterns, data, in.Password)
+		} else {
+			c, err = NewClientCertFromPEM(in.Patterns, []byte(in.CertPEM), []byte(in.KeyPEM))
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_CERT", err.Error(), nil)
+			return
+		}
+		d.ClientCerts.Add(c)
+	case http.MethodDelete:
+		certID := r.URL.Query().Get("id")
+		if certID == "" {
+			writeError(w, http.StatusBadRequest, "MISSING_ID", "missing id", nil)
+			return
+		}
+		if !d.ClientCerts.Remove(certID) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "client certificate not found", map[string]any{"id": certID})
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET, POST or DELETE", nil)
+		return
+	}
+	if r.Method != http.MethodGet && d.Transports != nil {
+		// kept-alive connections were authenticated with the previous identity
+		d.Transports.CloseIdleConnections()
+	}
+	items := []clientCertDTO{}
+	for _, c := range d.ClientCerts.List() {
+		items = append(items, clientCertDTO{ID: c.ID, Patterns: c.Patterns, Subject: c.Subject, Fingerprint: c.Fingerprint, NotAfter: c.NotAfter})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
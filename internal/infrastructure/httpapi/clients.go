@@ -0,0 +1,293 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clientIDHeader lets a device name itself; it is stripped before the request goes upstream.
+const clientIDHeader = "X-Debugger-Client"
+
+// maxClients bounds the registry; the least recently seen unnamed client is dropped first.
+const maxClients = 1024
+
+// Client is a device or tester seen by the proxy. Its id is derived from the first
+// identification source that yields a value (CLIENT_ID_SOURCES), so it is stable across
+// reconnects and restarts; the registry itself (names, settings) is in memory only.
+type Client struct {
+	ID string `json:"id"`
+	// Name is a friendly label set via /_api/v1/clients
+	Name string `json:"name,omitempty"`
+	// Source is what identified the client: "header" (X-Debugger-Client), "user" (proxy auth),
+	// "ip" or "ua" (User-Agent fingerprint); Key is the identifying value.
+	Source    string         `json:"source"`
+	Key       string         `json:"key"`
+	IP        string         `json:"ip,omitempty"`
+	User      string         `json:"user,omitempty"`
+	UserAgent string         `json:"userAgent,omitempty"`
+	FirstSeen time.Time      `json:"firstSeen"`
+	LastSeen  time.Time      `json:"lastSeen"`
+	Settings  ClientSettings `json:"settings"`
+}
+
+// ClientSettings apply to every session of one client.
+type ClientSettings struct {
+	// Throttle names a network profile ("lte", "fast-3g", "slow-3g"; "" = none) applied to
+	// captured HTTP responses.
+	Throttle string `json:"throttle,omitempty"`
+	// MITM overrides the interception rules for the client: "intercept" | "passthrough" ("" = rules).
+	MITM string `json:"mitm,omitempty"`
+}
+
+func (s ClientSettings) validate() error {
+	if _, ok := throttleProfiles[s.Throttle]; s.Throttle != "" && !ok {
+		return errors.New("unknown throttle profile " + s.Throttle)
+	}
+	if s.MITM != "" && s.MITM != "intercept" && s.MITM != "passthrough" {
+		return errors.New("mitm must be intercept or passthrough")
+	}
+	return nil
+}
+
+// clientInfo is what a connection or request tells about its client.
+type clientInfo struct {
+	ip, user, header, ua string
+}
+
+func (d *Deps) clientOfRequest(r *http.Request) clientInfo {
+	return clientInfo{ip: clientHost(r.RemoteAddr), user: proxyUser(r.Context()), header: r.Header.Get(clientIDHeader), ua: r.Header.Get("User-Agent")}
+}
+
+// ClientRegistry identifies clients and keeps their names and settings.
+type ClientRegistry struct {
+	sources []string
+	mu      sync.RWMutex
+	clients map[string]*Client
+}
+
+var clientIDSources = map[string]bool{"header": true, "user": true, "ip": true, "ua": true}
+
+// ParseClientIDSources parses CLIENT_ID_SOURCES, e.g. "header,user,ip" (the default).
+func ParseClientIDSources(s string) ([]string, error) {
+	var out []string
+	for _, src := range strings.Split(s, ",") {
+		src = strings.ToLower(strings.TrimSpace(src))
+		if src == "" {
+			continue
+		}
+		if !clientIDSources[src] {
+			return nil, errors.New("unknown client id source " + src + " (want header, user, ip or ua)")
+		}
+		out = append(out, src)
+	}
+	if len(out) == 0 {
+		out = []string{"header", "user", "ip"}
+	}
+	return out, nil
+}
+
+func NewClientRegistry(sources []string) *ClientRegistry {
+	return &ClientRegistry{sources: sources, clients: make(map[string]*Client)}
+}
+
+// identify returns the id of the client described by ci, registering it on first sight
+// ("" when no source yields a value).
+func (c *ClientRegistry) identify(ci clientInfo) string {
+	if c == nil {
+		return ""
+	}
+	var source, key string
+	for _, src := range c.sources {
+		switch src {
+		case "header":
+			key = strings.TrimSpace(ci.header)
+		case "user":
+			key = ci.user
+		case "ip":
+			key = ci.ip
+		case "ua":
+			key = ci.ua
+		}
+		if key != "" {
+			source = src
+			break
+		}
+	}
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(source + "\x00" + key))
+	clientID := "c-" + hex.EncodeToString(sum[:6])
+	now := time.Now().UTC()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cl, ok := c.clients[clientID]
+	if !ok {
+		c.evictLocked()
+		cl = &Client{ID: clientID, Source: source, Key: key, FirstSeen: now}
+		if source == "ua" {
+			// fingerprint only: the raw User-Agent is kept separately
+			cl.Key = clientID[2:]
+		}
+		c.clients[clientID] = cl
+	}
+	cl.LastSeen = now
+	if ci.ip != "" {
+		cl.IP = ci.ip
+	}
+	if ci.user != "" {
+		cl.User = ci.user
+	}
+	if ci.ua != "" {
+		cl.UserAgent = ci.ua
+	}
+	return clientID
+}
+
+func (c *ClientRegistry) evictLocked() {
+	if len(c.clients) < maxClients {
+		return
+	}
+	var oldest *Client
+	for _, cl := range c.clients {
+		if cl.Name == "" && cl.Settings == (ClientSettings{}) && (oldest == nil || cl.LastSeen.Before(oldest.LastSeen)) {
+			oldest = cl
+		}
+	}
+	if oldest != nil {
+		delete(c.clients, oldest.ID)
+	}
+}
+
+// settings returns the settings of a client (zero value for unknown ids).
+func (c *ClientRegistry) settings(clientID string) ClientSettings {
+	if c == nil || clientID == "" {
+		return ClientSettings{}
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if cl, ok := c.clients[clientID]; ok {
+		return cl.Settings
+	}
+	return ClientSettings{}
+}
+
+// List returns the known clients, most recently seen first.
+func (c *ClientRegistry) List() []Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]Client, 0, len(c.clients))
+	for _, cl := range c.clients {
+		out = append(out, *cl)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+// update sets the name and/or settings of a known client.
+func (c *ClientRegistry) update(clientID string, name *string, settings *ClientSettings) (bool, error) {
+	if settings != nil {
+		if err := settings.validate(); err != nil {
+			return false, err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cl, ok := c.clients[clientID]
+	if !ok {
+		return false, nil
+	}
+	if name != nil {
+		cl.Name = strings.TrimSpace(*name)
+	}
+	if settings != nil {
+		cl.Settings = *settings
+	}
+	return true, nil
+}
+
+func (c *ClientRegistry) forget(clientID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.clients[clientID]
+	delete(c.clients, clientID)
+	return ok
+}
+
+// handleV1Clients manages the client registry:
+// GET lists clients; PUT ?id=… {name?, settings?} updates one; DELETE ?id=… forgets one.
+func (d *Deps) handleV1Clients(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		clientID := r.URL.Query().Get("id")
+		if clientID == "" {
+			writeError(w, http.StatusBadRequest, "MISSING_ID", "missing id", nil)
+			return
+		}
+		var in struct {
+			Name     *string         `json:"name"`
+			Settings *ClientSettings `json:"settings"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+			return
+		}
+		found, err := d.Clients.update(clientID, in.Name, in.Settings)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", err.Error(), nil)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "client not found", map[string]any{"id": clientID})
+			return
+		}
+	case http.MethodDelete:
+		clientID := r.URL.Query().Get("id")
+		if clientID == "" {
+			writeError(w, http.StatusBadRequest, "MISSING_ID", "missing id", nil)
+			return
+		}
+		if !d.Clients.forget(clientID) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "client not found", map[string]any{"id": clientID})
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET, PUT or DELETE", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": d.Clients.List()})
+}
+
+type clientIDKey struct{}
+
+// withClientID attributes the tunnels created under ctx to a client.
+func withClientID(ctx context.Context, clientID string) context.Context {
+	if clientID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, clientIDKey{}, clientID)
+}
+
+func clientIDFrom(ctx context.Context) string {
+	v, _ := ctx.Value(clientIDKey{}).(string)
+	return v
+}
+
+// clientHost returns the IP of a "host:port" remote address (IPv6 without brackets).
+func clientHost(remote string) string {
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return strings.Trim(remote, "[]")
+}
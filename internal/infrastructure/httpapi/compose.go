@@ -0,0 +1,257 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+type composeFieldV1 struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type composeFileV1 struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	// ContentBase64 carries the file bytes.
+	ContentBase64 string `json:"contentBase64"`
+}
+
+type composeBodyV1 struct {
+	// Type: none|raw|json|form|multipart. Inferred from the filled field when empty.
+	Type string `json:"type"`
+	Raw  string `json:"raw"`
+	// RawEncoding: "" (utf8) or "base64" for binary raw payloads.
+	RawEncoding string            `json:"rawEncoding"`
+	JSON        json.RawMessage   `json:"json"`
+	Form        []composeFieldV1  `json:"form"`
+	Multipart   *composeMultipart `json:"multipart"`
+}
+
+type composeMultipart struct {
+	Fields []composeFieldV1 `json:"fields"`
+	Files  []composeFileV1  `json:"files"`
+}
+
+type composeOptionsV1 struct {
+	FollowRedirects bool `json:"followRedirects"`
+	MaxRedirects    int  `json:"maxRedirects"`
+	TimeoutMs       int  `json:"timeoutMs"`
+	// HTTPVersion: "" (negotiate), "1.1" or "2".
+	HTTPVersion string `json:"httpVersion"`
+}
+
+type composeRequestV1 struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    composeBodyV1     `json:"body"`
+	Options composeOptionsV1  `json:"options"`
+}
+
+type composeResponseV1 struct {
+	SessionID string `json:"sessionId"`
+	// SessionIDs lists every hop when redirects were followed.
+	SessionIDs   []string           `json:"sessionIds"`
+	Status       int                `json:"status"`
+	Headers      map[string]string  `json:"headers,omitempty"`
+	Body         string             `json:"body"`
+	BodyEncoding string             `json:"bodyEncoding"`
+	Truncated    bool               `json:"truncated"`
+	Timings      domain.HTTPTimings `json:"timings"`
+	Error        *apiError          `json:"error,omitempty"`
+}
+
+// handleV1Compose handles POST /_api/v1/compose: builds a request from scratch and sends it
+// through the same capture pipeline as replay, so it appears as a regular http session.
+func (d *Deps) handleV1Compose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use POST", nil)
+		return
+	}
+	var in composeRequestV1
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+		return
+	}
+	method := strings.ToUpper(strings.TrimSpace(in.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	u, err := url.Parse(strings.TrimSpace(in.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_TARGET", "url must be absolute http(s) url", map[string]any{"url": in.URL})
+		return
+	}
+	if _, err := normalizeHTTPVersion(in.Options.HTTPVersion); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_VALUE", err.Error(), map[string]any{"httpVersion": in.Options.HTTPVersion})
+		return
+	}
+	body, contentType, err := buildComposeBody(in.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_BODY", err.Error(), nil)
+		return
+	}
+
+	ctx := r.Context()
+	if in.Options.TimeoutMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(in.Options.TimeoutMs)*time.Millisecond)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error(), nil)
+		return
+	}
+	if len(body) == 0 {
+		req.Body = http.NoBody
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range in.Headers {
+		req.Header.Set(k, v)
+	}
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if h := req.Header.Get("Host"); h != "" {
+		req.Host = h
+		req.Header.Del("Host")
+	}
+
+	sess := domain.Session{ID: id.New(), Target: u.String(), ClientAddr: clientHost(r.RemoteAddr), ClientID: d.Clients.identify(d.clientOfRequest(r)), User: proxyUser(r.Context())}
+	opts := issueOptions{HTTPVersion: in.Options.HTTPVersion, FollowRedirects: in.Options.FollowRedirects, MaxRedirects: in.Options.MaxRedirects}
+	hops, err := d.issueFollowingRedirects(ctx, sess, req, body, opts)
+
+	out := composeResponseV1{SessionIDs: make([]string, 0, len(hops))}
+	for _, h := range hops {
+		out.SessionIDs = append(out.SessionIDs, h.SessionID)
+	}
+	last := hops[len(hops)-1]
+	out.SessionID = last.SessionID
+	out.Status = last.Status
+	out.Truncated = last.Truncated
+	out.Timings = last.Tx.Timings
+	if last.Header != nil {
+		out.Headers = make(map[string]string, len(last.Header))
+		for k, vv := range last.Header {
+			out.Headers[k] = strings.Join(vv, ", ")
+		}
+	}
+	if utf8.Valid(last.Body) {
+		out.Body, out.BodyEncoding = string(last.Body), "utf8"
+	} else {
+		out.Body, out.BodyEncoding = base64.StdEncoding.EncodeToString(last.Body), "base64"
+	}
+	if err != nil {
+		code, msg := humanizeProxyError(err)
+		out.Error = &apiError{Code: code, Message: msg, Details: map[string]any{"raw": err.Error()}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil && last.Status == 0 {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// buildComposeBody encodes the composer body and returns a default Content-Type for it.
+func buildComposeBody(b composeBodyV1) ([]byte, string, error) {
+	typ := strings.ToLower(b.Type)
+	if typ == "" {
+		switch {
+		case b.Multipart != nil:
+			typ = "multipart"
+		case len(b.Form) > 0:
+			typ = "form"
+		case len(b.JSON) > 0:
+			typ = "json"
+		case b.Raw != "":
+			typ = "raw"
+		default:
+			typ = "none"
+		}
+	}
+	switch typ {
+	case "none":
+		return nil, "", nil
+	case "raw":
+		if b.RawEncoding == "base64" {
+			raw, err := base64.StdEncoding.DecodeString(b.Raw)
+			if err != nil {
+				return nil, "", errors.New("raw: invalid base64")
+			}
+			return raw, "application/octet-stream", nil
+		}
+		return []byte(b.Raw), "", nil
+	case "json":
+		if len(b.JSON) == 0 {
+			return nil, "", errors.New("json: empty body")
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, b.JSON); err != nil {
+			return nil, "", errors.New("json: " + err.Error())
+		}
+		return buf.Bytes(), "application/json", nil
+	case "form":
+		vals := url.Values{}
+		for _, f := range b.Form {
+			vals.Add(f.Name, f.Value)
+		}
+		return []byte(vals.Encode()), "application/x-www-form-urlencoded", nil
+	case "multipart":
+		if b.Multipart == nil {
+			return nil, "", errors.New("multipart: missing parts")
+		}
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, f := range b.Multipart.Fields {
+			if err := mw.WriteField(f.Name, f.Value); err != nil {
+				return nil, "", err
+			}
+		}
+		for _, f := range b.Multipart.Files {
+			data, err := base64.StdEncoding.DecodeString(f.ContentBase64)
+			if err != nil {
+				return nil, "", errors.New("multipart: invalid base64 in file " + f.Name)
+			}
+			h := make(textproto.MIMEHeader)
+			h.Set("Content-Disposition", `form-data; name="`+escapeQuotes(f.Name)+`"; filename="`+escapeQuotes(f.Filename)+`"`)
+			ct := f.ContentType
+			if ct == "" {
+				ct = "application/octet-stream"
+			}
+			h.Set("Content-Type", ct)
+			pw, err := mw.CreatePart(h)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err := pw.Write(data); err != nil {
+				return nil, "", err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), mw.FormDataContentType(), nil
+	default:
+		return nil, "", errors.New("unknown body type: " + b.Type)
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string { return quoteEscaper.Replace(s) }
@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"io"
 	"network-debugger/internal/infrastructure/config"
 	"time"
 )
@@ -21,3 +22,48 @@ func sleepResponseDelay(cfg config.Config) {
 		time.Sleep(time.Duration(cfg.ResponseDelayMs) * time.Millisecond)
 	}
 }
+
+// throttleProfile emulates a slow network per client: added latency before the response and a
+// download bandwidth cap on its body (values follow the browser devtools presets).
+type throttleProfile struct {
+	latency  time.Duration
+	downKbps int
+}
+
+var throttleProfiles = map[string]throttleProfile{
+	"lte":     {latency: 70 * time.Millisecond, downKbps: 12000},
+	"fast-3g": {latency: 563 * time.Millisecond, downKbps: 1600},
+	"slow-3g": {latency: 2000 * time.Millisecond, downKbps: 400},
+}
+
+// throttledBody paces reads so the body arrives no faster than kbps.
+type throttledBody struct {
+	io.ReadCloser
+	kbps  int
+	start time.Time
+	n     int64
+}
+
+func newThrottledBody(body io.ReadCloser, kbps int) io.ReadCloser {
+	if body == nil || kbps <= 0 {
+		return body
+	}
+	return &throttledBody{ReadCloser: body, kbps: kbps}
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if b.start.IsZero() {
+		b.start = time.Now()
+	}
+	// small reads keep the pacing smooth: at most ~50ms worth of data per call
+	if chunk := b.kbps * 1000 / 8 / 20; chunk > 0 && len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	due := time.Duration(b.n * 8 * int64(time.Millisecond) / int64(b.kbps))
+	if wait := due - time.Since(b.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
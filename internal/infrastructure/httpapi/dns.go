@@ -0,0 +1,301 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"network-debugger/internal/domain"
+)
+
+// DNSResolver applies /etc/hosts-style overrides and an optional custom DNS server
+// to every outbound dial (HTTP transport, WS dialer, CONNECT tunnels, MITM upstream).
+// Only the dialed address changes: SNI and the Host header keep the original name.
+type DNSResolver struct {
+	mu sync.RWMutex
+	// overrides: lower-case host (or "*.suffix" pattern) -> IP literal
+	overrides map[string]string
+	// server is "ip:port" of a custom DNS server; empty means the system resolver
+	server   string
+	resolver *net.Resolver
+}
+
+// NewDNSResolver creates a resolver; server may be empty (system resolver) or "ip[:port]".
+func NewDNSResolver(server string, overrides map[string]string) (*DNSResolver, error) {
+	r := &DNSResolver{overrides: map[string]string{}}
+	if err := r.SetServer(server); err != nil {
+		return r, err
+	}
+	for h, ip := range overrides {
+		if err := r.SetOverride(h, ip); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// ParseDNSOverrides parses DNS_OVERRIDES: "api.prod.example.com=127.0.0.1,*.staging.local=10.0.0.5".
+func ParseDNSOverrides(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		host, ip, ok := strings.Cut(p, "=")
+		if !ok {
+			return out, errors.New("dns override without '=': " + p)
+		}
+		out[strings.TrimSpace(host)] = strings.TrimSpace(ip)
+	}
+	return out, nil
+}
+
+// SetServer switches the custom DNS server ("" restores the system resolver).
+func (r *DNSResolver) SetServer(server string) error {
+	server = strings.TrimSpace(server)
+	var res *net.Resolver
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		host, _, _ := net.SplitHostPort(server)
+		if net.ParseIP(host) == nil {
+			return errors.New("dns server must be an IP address: " + server)
+		}
+		addr := server
+		res = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, network, addr)
+			},
+		}
+	}
+	r.mu.Lock()
+	r.server, r.resolver = server, res
+	r.mu.Unlock()
+	return nil
+}
+
+// Server returns the configured custom DNS server ("" = system).
+func (r *DNSResolver) Server() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.server
+}
+
+// SetOverride maps host (exact or "*.suffix") to an IP literal.
+func (r *DNSResolver) SetOverride(host, ip string) error {
+	host = strings.ToLower(strings.TrimSpace(host))
+	ip = strings.Trim(strings.TrimSpace(ip), "[]")
+	if host == "" {
+		return errors.New("dns override: empty host")
+	}
+	if net.ParseIP(ip) == nil {
+		return errors.New("dns override: invalid ip for " + host + ": " + ip)
+	}
+	r.mu.Lock()
+	r.overrides[host] = ip
+	r.mu.Unlock()
+	return nil
+}
+
+// DeleteOverride removes the override for host.
+func (r *DNSResolver) DeleteOverride(host string) {
+	r.mu.Lock()
+	delete(r.overrides, strings.ToLower(strings.TrimSpace(host)))
+	r.mu.Unlock()
+}
+
+// Overrides returns a copy of the current overrides.
+func (r *DNSResolver) Overrides() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]string, len(r.overrides))
+	for k, v := range r.overrides {
+		out[k] = v
+	}
+	return out
+}
+
+// replaceWith atomically adopts server and overrides of next.
+func (r *DNSResolver) replaceWith(next *DNSResolver) {
+	next.mu.RLock()
+	server, res, ov := next.server, next.resolver, next.overrides
+	next.mu.RUnlock()
+	r.mu.Lock()
+	r.server, r.resolver, r.overrides = server, res, ov
+	r.mu.Unlock()
+}
+
+// lookupOverride returns the override IP for host; exact entries win over "*.suffix" patterns,
+// longer patterns win over shorter ones.
+func (r *DNSResolver) lookupOverride(host string) (string, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if ip, ok := r.overrides[host]; ok {
+		return ip, true
+	}
+	best, bestIP := "", ""
+	for p, ip := range r.overrides {
+		if strings.HasPrefix(p, "*.") && matchUpstreamPattern(p, host) && len(p) > len(best) {
+			best, bestIP = p, ip
+		}
+	}
+	return bestIP, best != ""
+}
+
+// RewriteAddr applies overrides to "host:port"; other addresses are returned unchanged.
+func (r *DNSResolver) RewriteAddr(addr string) string {
+	if r == nil {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip, ok := r.lookupOverride(host); ok {
+		return net.JoinHostPort(ip, port)
+	}
+	return addr
+}
+
+// LookupIP resolves host to one IP address honouring overrides and the custom DNS server.
+func (r *DNSResolver) LookupIP(ctx context.Context, host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	res := net.DefaultResolver
+	if r != nil {
+		if ip, ok := r.lookupOverride(host); ok {
+			return ip, nil
+		}
+		r.mu.RLock()
+		if r.resolver != nil {
+			res = r.resolver
+		}
+		r.mu.RUnlock()
+	}
+	addrs, err := res.LookupHost(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	return addrs[0], nil
+}
+
+type pinnedDialKey struct{}
+
+type pinnedDial struct{ addr, dialAddr string }
+
+// withPinnedDial makes dials to addr made with the returned context go to dialAddr instead;
+// the transparent listener uses it so the name is not resolved back to the debugger.
+func withPinnedDial(ctx context.Context, addr, dialAddr string) context.Context {
+	return context.WithValue(ctx, pinnedDialKey{}, pinnedDial{addr: addr, dialAddr: dialAddr})
+}
+
+// pinnedAddr returns the address pinned for addr in ctx, or addr itself.
+func pinnedAddr(ctx context.Context, addr string) string {
+	if p, ok := ctx.Value(pinnedDialKey{}).(pinnedDial); ok && strings.EqualFold(p.addr, addr) {
+		return p.dialAddr
+	}
+	return addr
+}
+
+// DialContext dials addr honouring overrides and the custom DNS server.
+func (r *DNSResolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	addr = pinnedAddr(ctx, addr)
+	if r != nil {
+		addr = r.RewriteAddr(addr)
+		r.mu.RLock()
+		dialer.Resolver = r.resolver
+		r.mu.RUnlock()
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+type dnsSettingsDTO struct {
+	Server    string            `json:"server"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+type dnsOverrideDTO struct {
+	Host string `json:"host"`
+	IP   string `json:"ip"`
+}
+
+// handleV1DNS manages DNS overrides at runtime:
+// GET returns {server, overrides}; PUT replaces both; POST {host, ip} adds one override;
+// DELETE ?host=… removes one override.
+func (d *Deps) handleV1DNS(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var in dnsSettingsDTO
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+			return
+		}
+		next, err := NewDNSResolver(in.Server, in.Overrides)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", err.Error(), nil)
+			return
+		}
+		d.DNS.replaceWith(next)
+	case http.MethodPost:
+		var in dnsOverrideDTO
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+			return
+		}
+		if err := d.DNS.SetOverride(in.Host, in.IP); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", err.Error(), nil)
+			return
+		}
+	case http.MethodDelete:
+		host := r.URL.Query().Get("host")
+		if host == "" {
+			writeError(w, http.StatusBadRequest, "MISSING_HOST", "missing host", nil)
+			return
+		}
+		d.DNS.DeleteOverride(host)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET, PUT, POST or DELETE", nil)
+		return
+	}
+	if r.Method != http.MethodGet && d.Transports != nil {
+		// pooled keep-alive connections may point at the old addresses
+		d.Transports.CloseIdleConnections()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(dnsSettingsDTO{Server: d.DNS.Server(), Overrides: d.DNS.Overrides()})
+}
+
+// recordServerIP stores the dialed upstream IP on the session (first value wins).
+func (d *Deps) recordServerIP(sessionID, ip string) {
+	if ip == "" {
+		return
+	}
+	_ = d.Svc.UpdateSession(contextWithNoCancel(), sessionID, func(s *domain.Session) {
+		if s.ServerIP == "" {
+			s.ServerIP = ip
+		}
+	})
+}
+
+// remoteIP extracts the IP part of a connection's remote address ("" when unknown).
+func remoteIP(c net.Conn) string {
+	if c == nil || c.RemoteAddr() == nil {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(c.RemoteAddr().String()); err == nil {
+		return h
+	}
+	return c.RemoteAddr().String()
+}
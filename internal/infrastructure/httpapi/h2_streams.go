@@ -0,0 +1,205 @@
+package httpapi
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2 frame types/flags needed to follow request header blocks (RFC 9113 §6).
+const (
+	h2FrameHeaders      = 0x1
+	h2FrameContinuation = 0x9
+	h2FlagEndHeaders    = 0x4
+	h2FlagPadded        = 0x8
+	h2FlagPriority      = 0x20
+	h2ClientPreface     = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	// h2MaxHeaderBlock bounds one buffered header block; larger blocks stop stream tracking.
+	h2MaxHeaderBlock = 1 << 20
+)
+
+// h2StreamTracker follows the client->proxy byte stream of a decrypted h2 connection and
+// remembers the stream id of every request header block. http2.Server does not expose stream
+// ids to handlers, so a handler takes the id recorded for its method/authority/path; identical
+// concurrent requests are told apart in arrival order. Payloads other than header blocks are
+// skipped without buffering.
+type h2StreamTracker struct {
+	mu       sync.Mutex
+	preface  int
+	hdr      [9]byte
+	hdrN     int
+	skip     uint32
+	need     uint32
+	payload  []byte
+	flags    byte
+	typ      byte
+	streamID uint32
+	// block accumulates HEADERS + CONTINUATION fragments of blockStream
+	block       []byte
+	blockStream uint32
+	dec         *hpack.Decoder
+	broken      bool
+	pending     map[string][]uint32
+}
+
+func newH2StreamTracker() *h2StreamTracker {
+	// the server advertises the default 4096 byte header table, so the client encoder stays within it
+	return &h2StreamTracker{dec: hpack.NewDecoder(4096, nil), pending: map[string][]uint32{}}
+}
+
+func h2RequestKey(method, authority, path string) string {
+	return method + " " + authority + path
+}
+
+// feed consumes bytes read from the client.
+func (t *h2StreamTracker) feed(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(p) > 0 && !t.broken {
+		switch {
+		case t.preface < len(h2ClientPreface):
+			n := len(h2ClientPreface) - t.preface
+			if n > len(p) {
+				n = len(p)
+			}
+			t.preface += n
+			p = p[n:]
+		case t.skip > 0:
+			n := t.skip
+			if n > uint32(len(p)) {
+				n = uint32(len(p))
+			}
+			t.skip -= n
+			p = p[n:]
+		case t.need > 0:
+			n := t.need
+			if n > uint32(len(p)) {
+				n = uint32(len(p))
+			}
+			t.payload = append(t.payload, p[:n]...)
+			t.need -= n
+			p = p[n:]
+			if t.need == 0 {
+				t.frameDone()
+			}
+		default:
+			n := copy(t.hdr[t.hdrN:], p)
+			t.hdrN += n
+			p = p[n:]
+			if t.hdrN < len(t.hdr) {
+				continue
+			}
+			t.hdrN = 0
+			length := uint32(t.hdr[0])<<16 | uint32(t.hdr[1])<<8 | uint32(t.hdr[2])
+			t.typ, t.flags = t.hdr[3], t.hdr[4]
+			t.streamID = binary.BigEndian.Uint32(t.hdr[5:9]) & 0x7fffffff
+			if t.typ != h2FrameHeaders && t.typ != h2FrameContinuation {
+				t.skip = length
+				continue
+			}
+			t.payload = t.payload[:0]
+			t.need = length
+			if length == 0 {
+				t.frameDone()
+			}
+		}
+	}
+}
+
+func (t *h2StreamTracker) frameDone() {
+	frag := t.payload
+	if t.typ == h2FrameHeaders {
+		if t.flags&h2FlagPadded != 0 {
+			if len(frag) < 1 || int(frag[0]) > len(frag)-1 {
+				t.broken = true
+				return
+			}
+			frag = frag[1 : len(frag)-int(frag[0])]
+		}
+		if t.flags&h2FlagPriority != 0 {
+			if len(frag) < 5 {
+				t.broken = true
+				return
+			}
+			frag = frag[5:]
+		}
+		t.block = append(t.block[:0], frag...)
+		t.blockStream = t.streamID
+	} else {
+		if t.streamID != t.blockStream || len(t.block)+len(frag) > h2MaxHeaderBlock {
+			t.broken = true
+			return
+		}
+		t.block = append(t.block, frag...)
+	}
+	if t.flags&h2FlagEndHeaders == 0 {
+		return
+	}
+	// every block must be decoded (trailers too) to keep the HPACK dynamic table in sync
+	fields, err := t.dec.DecodeFull(t.block)
+	if err != nil {
+		t.broken = true
+		return
+	}
+	var method, authority, path, host string
+	for _, f := range fields {
+		switch f.Name {
+		case ":method":
+			method = f.Value
+		case ":authority":
+			authority = f.Value
+		case ":path":
+			path = f.Value
+		case "host":
+			host = f.Value
+		}
+	}
+	if method == "" {
+		return
+	}
+	if authority == "" {
+		authority = host
+	}
+	k := h2RequestKey(method, authority, path)
+	// requests rejected before reaching a handler never take their id; keep the queues short
+	if q := t.pending[k]; len(q) >= 64 {
+		t.pending[k] = q[1:]
+	}
+	t.pending[k] = append(t.pending[k], t.blockStream)
+}
+
+// take returns the stream id recorded for a request (0 when unknown).
+func (t *h2StreamTracker) take(method, authority, path string) uint32 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := h2RequestKey(method, authority, path)
+	q := t.pending[k]
+	if len(q) == 0 {
+		return 0
+	}
+	if len(q) == 1 {
+		delete(t.pending, k)
+	} else {
+		t.pending[k] = q[1:]
+	}
+	return q[0]
+}
+
+// h2TrackedConn feeds everything the server reads from the client into the tracker.
+type h2TrackedConn struct {
+	net.Conn
+	t *h2StreamTracker
+}
+
+func (c *h2TrackedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.t.feed(p[:n])
+	}
+	return n, err
+}
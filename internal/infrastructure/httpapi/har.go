@@ -3,7 +3,10 @@ package httpapi
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
+
+	"network-debugger/internal/domain"
 )
 
 // Minimal HAR 1.2 structs for export
@@ -21,6 +24,9 @@ type harEntry struct {
 	Time            int64       `json:"time"`
 	Request         harRequest  `json:"request"`
 	Response        harResponse `json:"response"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Connection      string      `json:"connection,omitempty"`
 }
 type harRequest struct {
 	Method      string `json:"method"`
@@ -35,6 +41,29 @@ type harResponse struct {
 	BodySize    int    `json:"bodySize"`
 }
 
+// harTimings follows HAR 1.2: -1 marks a phase that does not apply (e.g. dns/connect/ssl on a
+// reused connection); connect includes ssl.
+type harTimings struct {
+	Blocked int64 `json:"blocked"`
+	DNS     int64 `json:"dns"`
+	Connect int64 `json:"connect"`
+	Send    int64 `json:"send"`
+	Wait    int64 `json:"wait"`
+	Receive int64 `json:"receive"`
+	SSL     int64 `json:"ssl"`
+}
+
+func harTimingsFor(tx domain.HTTPTransaction) harTimings {
+	t := tx.Timings
+	out := harTimings{Blocked: t.Blocked, DNS: t.DNS, Connect: t.Connect + t.TLS, Send: t.Send, Wait: t.Wait, Receive: t.Receive, SSL: t.TLS}
+	if tx.ConnReused {
+		out.DNS, out.Connect, out.SSL = -1, -1, -1
+	} else if !strings.HasPrefix(strings.ToLower(tx.URL), "https:") {
+		out.SSL = -1
+	}
+	return out
+}
+
 func exportHARForSession(w http.ResponseWriter, r *http.Request, d *Deps, sessionID string) {
 	// collect all http txs
 	entries := make([]harEntry, 0, 256)
@@ -51,6 +80,9 @@ func exportHARForSession(w http.ResponseWriter, r *http.Request, d *Deps, sessio
 				Time:            tx.Timings.Total,
 				Request:         harRequest{Method: tx.Method, URL: tx.URL, HeadersSize: -1, BodySize: tx.ReqSize},
 				Response:        harResponse{Status: tx.Status, StatusText: http.StatusText(tx.Status), HeadersSize: -1, BodySize: tx.RespSize},
+				Timings:         harTimingsFor(tx),
+				ServerIPAddress: tx.ServerIPAddress,
+				Connection:      tx.ConnID,
 			})
 		}
 		if next == "" {
@@ -12,11 +12,7 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"net/http/httptrace"
-	"net/http/httputil"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -24,14 +20,17 @@ import (
 	"bufio"
 	"mime/multipart"
 	"network-debugger/internal/domain"
-	"network-debugger/pkg/shared/id"
 	"network-debugger/pkg/shared/redact"
-	"sync/atomic"
 )
 
 // handleHTTPProxy implements a simple reverse proxy that forwards requests to the `_target` upstream.
 // Path after /httpproxy is appended to target path. Query parameters (except `_target`) are passed through.
 func (d *Deps) handleHTTPProxy(w http.ResponseWriter, r *http.Request) {
+	user, ok := d.authorizeProxy(w, r)
+	if !ok {
+		return
+	}
+	r = r.WithContext(withProxyUser(r.Context(), user))
 	tgt := r.URL.Query().Get("_target")
 	if tgt == "" {
 		// fallback to default target from config
@@ -69,198 +68,30 @@ func (d *Deps) handleHTTPProxy(w http.ResponseWriter, r *http.Request) {
 		upstream.ForceQuery = false
 	}
 
-	sessionID := id.New()
-	sess := domain.Session{
-		ID:         sessionID,
-		Target:     upstream.String(),
-		ClientAddr: clientHost(r.RemoteAddr),
-		StartedAt:  time.Now().UTC(),
-		Kind:       "http",
+	d.captureHTTP(w, r, exchange{upstream: &upstream, via: "reverse"})
+}
+
+// finalizeHTTPTransaction recomputes timings after the response body was copied to the client
+// (receive phase, total), attaches captured body files and publishes (and returns) the updated transaction.
+func (d *Deps) finalizeHTTPTransaction(tx domain.HTTPTransaction, timer *httpTimer, reqSpool, respSpool *bodySpool) domain.HTTPTransaction {
+	end, n := timer.bodyDone()
+	if end.IsZero() {
+		end = time.Now()
 	}
-	if err := d.Svc.Create(r.Context(), sess); err != nil {
-		writeError(w, http.StatusInternalServerError, "SESSION_CREATE_FAILED", err.Error(), nil)
-		return
+	tx.Timings = timer.timings(end)
+	tx.EndedAt = end.UTC()
+	if tx.RespSize < 0 {
+		tx.RespSize = int(n)
 	}
-	d.Monitor.Broadcast(MonitorEvent{Type: "session_started", ID: sessionID})
-	d.Metrics.ActiveSessions.Inc()
-
-	// Create reverse proxy
-	director := func(req *http.Request) {
-		req.URL = &upstream
-		req.Host = upstream.Host
-		// Clean hop-by-hop headers; httputil will remove most, but ensure here for clarity
-		removeHopHeaders(req.Header)
-	}
-
-	transport := newTransport(d.Cfg)
-	// timings via httptrace
-	var tStart = time.Now()
-	var tDNSNs, tConnStartNs, tTLSStartNs, tFirstByteNs int64
-	hadError := false
-	proxy := &httputil.ReverseProxy{
-		Director:  director,
-		Transport: transport,
-		ModifyResponse: func(resp *http.Response) error {
-			// Artificial response delay (to visualize timeline)
-			sleepResponseDelay(d.Cfg)
-			// Log response frame with timings embedded
-			basePreview := buildHTTPResponsePreview(resp)
-			firstByte := timeFromUnixNanoOrZero(atomic.LoadInt64(&tFirstByteNs))
-			ttfb := durationMs(tStart, firstByte)
-			total := durationMs(tStart, time.Now())
-			preview := augmentPreviewWithTimings(basePreview, ttfb, total)
-			fr := domain.Frame{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionUpstreamToClient, Opcode: domain.OpcodeText, Size: int(resp.ContentLength), Preview: preview}
-			_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
-			d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
-			d.Metrics.FramesTotal.WithLabelValues(string(domain.DirectionUpstreamToClient), string(domain.OpcodeText)).Inc()
-
-			// Persist HTTP transaction summary
-			dnsStart := timeFromUnixNanoOrZero(atomic.LoadInt64(&tDNSNs))
-			connStart := timeFromUnixNanoOrZero(atomic.LoadInt64(&tConnStartNs))
-			tlsStart := timeFromUnixNanoOrZero(atomic.LoadInt64(&tTLSStartNs))
-			firstByte = timeFromUnixNanoOrZero(atomic.LoadInt64(&tFirstByteNs))
-			tx := domain.HTTPTransaction{
-				ID: id.New(), SessionID: sessionID, Method: r.Method, URL: strings.TrimSuffix(upstream.String(), "?"),
-				Status:  resp.StatusCode,
-				ReqSize: int(r.ContentLength), RespSize: int(resp.ContentLength),
-				StartedAt: tStart, EndedAt: time.Now().UTC(),
-				Timings: domain.HTTPTimings{
-					DNS:     durationMs(dnsStart, connStart),
-					Connect: durationMs(connStart, useOrFallback(tlsStart, firstByte)),
-					TLS:     durationMs(useOrFallback(tlsStart, firstByte), firstByte),
-					TTFB:    durationMs(tStart, firstByte),
-					Total:   durationMs(tStart, time.Now()),
-				},
-			}
-			// Best-effort content-type
-			if ct := resp.Header.Get("Content-Type"); ct != "" {
-				tx.ContentType = ct
-			}
-			// Optional body spooling
-			if d.Cfg.CaptureBodies {
-				if f, err := d.spoolBody(resp.Body, int64(d.Cfg.BodyMaxBytes), "resp"); err == nil && f != "" {
-					tx.RespBodyFile = f
-				}
-			}
-			_ = d.Svc.AddHTTPTransaction(contextWithNoCancel(), tx)
-			d.Monitor.Broadcast(MonitorEvent{Type: "http_tx_added", ID: sessionID, Ref: tx.ID})
-			return nil
-		},
-		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
-			hadError = true
-			_ = d.Svc.SetClosed(contextWithNoCancel(), sessionID, time.Now().UTC(), strPtr(err.Error()))
-
-			// Get human-readable error message and code
-			errorCode, errorMessage := humanizeProxyError(err)
-
-			// Enhanced logging with context
-			d.Logger.Error().
-				Err(err).
-				Str("sessionID", sessionID).
-				Str("target", upstream.String()).
-				Str("method", r.Method).
-				Str("clientAddr", clientHost(r.RemoteAddr)).
-				Str("errorCode", errorCode).
-				Msg(errorMessage)
-
-			// Broadcast error to frontend with user-friendly message
-			d.Monitor.Broadcast(MonitorEvent{
-				Type: "session_error",
-				ID:   sessionID,
-				Error: &ErrorDetails{
-					Code:    errorCode,
-					Message: errorMessage,
-					Raw:     err.Error(),
-					Target:  upstream.String(),
-					Method:  r.Method,
-				},
-			})
-			writeError(rw, http.StatusBadGateway, errorCode, errorMessage, map[string]any{"target": upstream.String(), "raw": err.Error()})
-		},
-	}
-
-	// Emit lightweight session-start heartbeat frame so UI can draw in-progress bar immediately.
-	{
-		hb := map[string]any{"type": "http_progress", "phase": "started"}
-		b, _ := json.Marshal(hb)
-		fr := domain.Frame{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionClientToUpstream, Opcode: domain.OpcodeText, Size: len(b), Preview: string(b)}
-		_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
-		d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
-	}
-
-	// Safely peek a small portion of request body and keep stream intact for upstream.
-	var reqBodyBuf []byte
-	if r.Body != nil {
-		peekSize := previewMaxBytes
-		if peekSize <= 0 {
-			peekSize = 65536
-		}
-		if peekSize > 65536 {
-			peekSize = 65536
-		}
-		peek := make([]byte, peekSize)
-		n, _ := io.ReadFull(r.Body, peek)
-		if n > 0 {
-			reqBodyBuf = peek[:n]
-			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBodyBuf), r.Body))
-		}
+	if reqSpool != nil {
+		tx.ReqBodyFile, tx.ReqBodyTruncated, _ = reqSpool.finish()
 	}
-	// Optional request body spooling
-	if d.Cfg.CaptureBodies && r.Body != nil {
-		if f, err := d.spoolBody(r.Body, int64(d.Cfg.BodyMaxBytes), "req"); err == nil && f != "" {
-			// rewind spooled for upstream
-			if fd, err2 := os.Open(f); err2 == nil {
-				r.Body = fd // upstream will read from file; fd will be closed by transport
-			}
-		}
+	if respSpool != nil {
+		tx.RespBodyFile, tx.RespBodyTruncated, _ = respSpool.finish()
 	}
-	// For preview, show the real upstream URL (not the /httpproxy path)
-	rPrev := *r
-	rPrev.URL = &upstream
-	reqPreview := buildHTTPRequestPreview(&rPrev, reqBodyBuf)
-	fr := domain.Frame{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionClientToUpstream, Opcode: domain.OpcodeText, Size: int64ToInt(r.ContentLength), Preview: reqPreview}
-	_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
-	d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
-	d.Metrics.FramesTotal.WithLabelValues(string(domain.DirectionClientToUpstream), string(domain.OpcodeText)).Inc()
-
-	// Also broadcast a lightweight event for frontend session_started consistency in HTTP flows
-	// (ws flow already broadcasts in network-debugger)
-	// d.Monitor.Broadcast(MonitorEvent{Type: "session_started", ID: sessionID}) // already sent above
-
-	// Attach httptrace to catch milestones (write times atomically; parallel dial may trigger concurrently)
-	r = r.WithContext(httptrace.WithClientTrace(r.Context(), &httptrace.ClientTrace{
-		DNSStart: func(info httptrace.DNSStartInfo) {
-			atomic.CompareAndSwapInt64(&tDNSNs, 0, time.Now().UnixNano())
-		},
-		ConnectStart: func(network, addr string) {
-			atomic.CompareAndSwapInt64(&tConnStartNs, 0, time.Now().UnixNano())
-		},
-		TLSHandshakeStart: func() {
-			atomic.CompareAndSwapInt64(&tTLSStartNs, 0, time.Now().UnixNano())
-		},
-		GotFirstResponseByte: func() {
-			atomic.CompareAndSwapInt64(&tFirstByteNs, 0, time.Now().UnixNano())
-		},
-	}))
-
-	// Standard forwarding headers (useful for logs/upstream)
-	if ip := clientHost(r.RemoteAddr); ip != "" {
-		r.Header.Set("X-Forwarded-For", ip)
-	}
-	if r.TLS != nil {
-		r.Header.Set("X-Forwarded-Proto", "https")
-	} else {
-		r.Header.Set("X-Forwarded-Proto", "http")
-	}
-	r.Header.Set("Via", "network-debugger")
-
-	// Serve
-	proxy.ServeHTTP(w, r)
-	if !hadError {
-		_ = d.Svc.SetClosed(contextWithNoCancel(), sessionID, time.Now().UTC(), nil)
-	}
-	d.Monitor.Broadcast(MonitorEvent{Type: "session_ended", ID: sessionID})
-	d.Metrics.ActiveSessions.Dec()
+	_ = d.Svc.UpdateHTTPTransaction(contextWithNoCancel(), tx)
+	d.Monitor.Broadcast(MonitorEvent{Type: "http_tx_updated", ID: tx.SessionID, Ref: tx.ID})
+	return tx
 }
 
 func removeHopHeaders(h http.Header) {
@@ -485,7 +316,10 @@ func buildHTTPResponsePreview(resp *http.Response) string {
 	// see note above
 	// best-effort: peek limited bytes and reattach back to resp.Body
 	var bodyBuf []byte
-	if resp.Body != nil {
+	if isStreamingResponse(resp) {
+		// never wait for stream data here: events may arrive minutes apart
+		preview["streaming"] = true
+	} else if resp.Body != nil {
 		// If gzip encoded, we do not decompress to avoid corrupting stream. We just sample raw bytes.
 		// Read a small chunk and then reattach it in front so client receives original body in full.
 		peekSize := previewMaxBytes
@@ -529,32 +363,6 @@ func buildHTTPResponsePreview(resp *http.Response) string {
 	return string(b)
 }
 
-// spoolBody writes up to max bytes from r into a temp file and returns the file path.
-// If BodySpoolDir is empty, uses os.CreateTemp default.
-func (d *Deps) spoolBody(r io.Reader, max int64, kind string) (string, error) {
-	dir := d.Cfg.BodySpoolDir
-	if dir == "" {
-		dir = os.TempDir()
-	}
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", err
-	}
-	f, err := os.CreateTemp(dir, "gpx-"+kind+"-*.bin")
-	if err != nil {
-		return "", err
-	}
-	defer func() { _ = f.Sync() }()
-	// limit copy
-	if _, err := io.CopyN(f, r, max); err != nil && err != io.EOF {
-		_ = f.Close()
-		return "", err
-	}
-	_ = f.Close()
-	// return path
-	abs, _ := filepath.Abs(f.Name())
-	return abs, nil
-}
-
 func tryCompactJSON(b []byte) string {
 	var js any
 	if json.Unmarshal(b, &js) == nil {
@@ -706,14 +514,6 @@ func durationMs(from time.Time, to time.Time) int64 {
 	return int64(to.Sub(from) / time.Millisecond)
 }
 
-// useOrFallback returns a if set, otherwise b. Helps when TLS phase отсутствует (plain HTTP).
-func useOrFallback(a, b time.Time) time.Time {
-	if a.IsZero() {
-		return b
-	}
-	return a
-}
-
 // timeFromUnixNanoOrZero конвертирует монотонно-независимые наносекунды в time.Time или возвращает нулевое время.
 func timeFromUnixNanoOrZero(ns int64) time.Time {
 	if ns <= 0 {
@@ -1,12 +1,13 @@
 package httpapi
 
 import (
+	"context"
 	"crypto/tls"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 
-	"network-debugger/internal/infrastructure/config"
-
 	http2 "golang.org/x/net/http2"
 )
 
@@ -33,19 +34,104 @@ func isWebSocketRequest(r *http.Request) bool {
 	return false
 }
 
-// newTransport centralizes http.Transport creation with TLS options/timeouts.
-func newTransport(cfg config.Config) *http.Transport {
+// buildTransport centralizes upstream transport creation with TLS options/timeouts for one
+// pool entry (see TransportPool). Upstream proxy selection (UPSTREAM_PROXY / UPSTREAM_PROXY_RULES)
+// and DNS overrides go through d.Upstream; dialed connections get ids for reuse tracking.
+// proto: "" negotiates (h2 via ALPN), "1.1" disables h2, "2" speaks HTTP/2 only
+// (h2 over TLS, h2c prior knowledge for plain http).
+func (d *Deps) buildTransport(s transportSettings) http.RoundTripper {
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := d.Upstream.DialDirect(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return newTrackedConn(c), nil
+	}
+	if s.proto == "2" {
+		// http2.Transport has no Proxy hook: dial through the upstream router (CONNECT/SOCKS5) ourselves
+		h2 := &http2.Transport{
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				tc, err := d.dialUpstreamTLS(ctx, network, addr, []string{http2.NextProtoTLS})
+				if err != nil {
+					return nil, err
+				}
+				if err := handshakeWithTrace(ctx, tc); err != nil {
+					return nil, err
+				}
+				return tc, nil
+			},
+		}
+		h2c := &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				raw, err := d.Upstream.DialerFor("http")(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				return newTrackedConn(raw), nil
+			},
+		}
+		return &h2OnlyTransport{tls: h2, h2c: h2c}
+	}
+	alpn := []string{http2.NextProtoTLS, "http/1.1"}
+	if s.proto == "1.1" {
+		alpn = []string{"http/1.1"}
+	}
 	tr := &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
+		// https is always dialed by DialTLSContext (upstream router handles CONNECT/SOCKS5 there),
+		// so TLS settings and client certificates are applied per connection in one place
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			if req.URL.Scheme == "https" {
+				return nil, nil
+			}
+			return d.Upstream.TransportProxy(req)
+		},
+		DialContext: dial,
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// http.Transport performs the handshake (and reports it to httptrace)
+			return d.dialUpstreamTLS(ctx, network, addr, alpn)
+		},
 		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   s.maxIdleConnsPerHost,
+		MaxConnsPerHost:       s.maxConnsPerHost,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
-	if cfg.InsecureTLS {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	if s.proto == "1.1" {
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		return tr
 	}
 	// Enable HTTP/2 for outbound HTTPS where possible. Safe to ignore error and fall back to HTTP/1.1
 	_ = http2.ConfigureTransport(tr)
 	return tr
 }
+
+// h2OnlyTransport speaks HTTP/2 with prior knowledge: TLS for https, h2c for plain http.
+type h2OnlyTransport struct {
+	tls *http2.Transport
+	h2c *http2.Transport
+}
+
+func (t *h2OnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+func (t *h2OnlyTransport) CloseIdleConnections() {
+	t.tls.CloseIdleConnections()
+	t.h2c.CloseIdleConnections()
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// closeIdleConnections releases pooled connections of transports that support it.
+func closeIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,294 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// InterceptRule decides whether matching CONNECT tunnels are decrypted ("intercept") or relayed
+// opaquely ("passthrough"). Empty criteria match everything; the first matching rule wins.
+type InterceptRule struct {
+	ID     string `json:"id"`
+	Action string `json:"action"` // "intercept" | "passthrough"
+	// Host is a glob ("*.example.com", "api-?.local"); HostRegex a regular expression. Both are
+	// matched case-insensitively against the host without port.
+	Host      string `json:"host,omitempty"`
+	HostRegex string `json:"hostRegex,omitempty"`
+	// Client is the client IP or CIDR; Port the CONNECT port (0 = any).
+	Client string `json:"client,omitempty"`
+	Port   int    `json:"port,omitempty"`
+
+	re     *regexp.Regexp
+	client *net.IPNet
+}
+
+// compile validates the rule and prepares its matchers.
+func (r *InterceptRule) compile() error {
+	if r.Action != "intercept" && r.Action != "passthrough" {
+		return errors.New("action must be intercept or passthrough")
+	}
+	r.Host = strings.ToLower(strings.TrimSpace(r.Host))
+	if r.Host != "" {
+		if _, err := path.Match(r.Host, ""); err != nil {
+			return errors.New("invalid host glob " + strconv.Quote(r.Host))
+		}
+	}
+	r.re = nil
+	if r.HostRegex != "" {
+		re, err := regexp.Compile("(?i)" + r.HostRegex)
+		if err != nil {
+			return errors.New("invalid hostRegex: " + err.Error())
+		}
+		r.re = re
+	}
+	r.client = nil
+	if r.Client != "" {
+		cidr := r.Client
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return errors.New("client must be an IP or CIDR")
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			cidr += "/" + strconv.Itoa(bits)
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.New("client must be an IP or CIDR")
+		}
+		r.client = n
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		return errors.New("port out of range")
+	}
+	return nil
+}
+
+func (r *InterceptRule) ruleID() string     { return r.ID }
+func (r *InterceptRule) setRuleID(v string) { r.ID = v }
+
+func (r *InterceptRule) matches(host, client string, port int) bool {
+	if r.Host != "" {
+		if ok, _ := path.Match(r.Host, host); !ok {
+			return false
+		}
+	}
+	if r.re != nil && !r.re.MatchString(host) {
+		return false
+	}
+	if r.client != nil {
+		ip := net.ParseIP(client)
+		if ip == nil || !r.client.Contains(ip) {
+			return false
+		}
+	}
+	return r.Port == 0 || r.Port == port
+}
+
+// LearnedPassthrough is a host tunneled opaquely because a client refused the MITM certificate.
+type LearnedPassthrough struct {
+	Host    string    `json:"host"`
+	Reason  string    `json:"reason"`
+	Client  string    `json:"client,omitempty"`
+	Learned time.Time `json:"learnedAt"`
+}
+
+// InterceptPolicy holds the runtime interception rules (/_api/v1/mitm/rules) and the hosts
+// learned to be pinned (/_api/v1/mitm/passthrough).
+type InterceptPolicy struct {
+	rules  ruleList[InterceptRule, *InterceptRule]
+	mu     sync.RWMutex
+	pinned map[string]LearnedPassthrough
+}
+
+func NewInterceptPolicy() *InterceptPolicy {
+	return &InterceptPolicy{pinned: make(map[string]LearnedPassthrough)}
+}
+
+// decide returns the action of the first matching rule ("" when none matches) and its id.
+func (p *InterceptPolicy) decide(host, client string, port int) (action, ruleID string) {
+	if p == nil {
+		return "", ""
+	}
+	r := p.rules.first(func(r *InterceptRule) bool { return r.matches(host, client, port) })
+	if r == nil {
+		return "", ""
+	}
+	return r.Action, r.ID
+}
+
+func (p *InterceptPolicy) isPinned(host string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.pinned[host]
+	return ok
+}
+
+func (p *InterceptPolicy) learn(e LearnedPassthrough) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pinned[e.Host]; !ok {
+		p.pinned[e.Host] = e
+	}
+}
+
+// Rules returns a copy of the rules in evaluation order.
+func (p *InterceptPolicy) Rules() []InterceptRule {
+	return p.rules.all()
+}
+
+// Learned returns the learned passthrough hosts sorted by host.
+func (p *InterceptPolicy) Learned() []LearnedPassthrough {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]LearnedPassthrough, 0, len(p.pinned))
+	for _, e := range p.pinned {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+// forget drops a learned host ("" drops all) and reports whether anything was removed.
+func (p *InterceptPolicy) forget(host string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if host == "" {
+		n := len(p.pinned)
+		p.pinned = make(map[string]LearnedPassthrough)
+		return n > 0
+	}
+	host = strings.ToLower(host)
+	_, ok := p.pinned[host]
+	delete(p.pinned, host)
+	return ok
+}
+
+// mitmDecision tells why a CONNECT is relayed opaquely ("" when it will be intercepted) and
+// which rule decided it. Order: learned passthrough, the client's mitm setting, runtime rules,
+// MITM_DOMAINS_ALLOW/DENY.
+func (d *Deps) mitmDecision(target, remoteAddr, clientID string) (skip, ruleID string) {
+	switch {
+	case d.MITM.Authority() != nil:
+	case d.MITM != nil || d.Cfg.MITMEnabled:
+		return "no_ca", ""
+	default:
+		return "disabled", ""
+	}
+	host, port := splitConnectTarget(target)
+	if d.Intercept.isPinned(host) {
+		return "pinned", ""
+	}
+	switch d.Clients.settings(clientID).MITM {
+	case "intercept":
+		return "", ""
+	case "passthrough":
+		return "client", ""
+	}
+	switch action, ruleID := d.Intercept.decide(host, clientHost(remoteAddr), port); action {
+	case "intercept":
+		return "", ruleID
+	case "passthrough":
+		return "denied", ruleID
+	}
+	if d.MITM.shouldIntercept(host) {
+		return "", ""
+	}
+	return "denied", ""
+}
+
+// recordMITMHandshakeFailure records a client that sent a ClientHello but did not finish the
+// handshake with our leaf certificate. A refusal (TLS alert or hang-up, typical for certificate
+// pinning) puts the host on the passthrough list when MITM_AUTO_PASSTHROUGH is on, so further
+// tunnels to it are relayed opaquely.
+func (d *Deps) recordMITMHandshakeFailure(tun *mitmTunnel, hello *tls.ClientHelloInfo, err error) {
+	host, _ := splitConnectTarget(tun.host)
+	learned := d.Cfg.MITMAutoPassthrough && clientRefusedCert(err)
+	msg := "client aborted the TLS handshake with the MITM certificate: " + err.Error()
+	if learned {
+		d.Intercept.learn(LearnedPassthrough{Host: host, Reason: err.Error(), Client: tun.clientAddr, Learned: time.Now().UTC()})
+		msg += "; host added to passthrough"
+	}
+	sessionID := id.New()
+	now := time.Now().UTC()
+	_ = d.Svc.Create(contextWithNoCancel(), domain.Session{
+		ID: sessionID, Target: "connect://" + tun.host, ClientAddr: tun.clientAddr, StartedAt: now, Kind: "tunnel", Via: tun.via, User: tun.user, ClientID: tun.clientID,
+		Tunnel: &domain.TunnelInfo{TLS: true, SNI: hello.ServerName, ALPN: append([]string(nil), hello.SupportedProtos...), PassthroughLearned: learned},
+	})
+	d.Monitor.Broadcast(MonitorEvent{Type: "session_started", ID: sessionID})
+	_ = d.Svc.SetClosed(contextWithNoCancel(), sessionID, now, &msg)
+	d.Monitor.Broadcast(MonitorEvent{Type: "session_ended", ID: sessionID})
+	if d.Logger != nil {
+		d.Logger.Info().Str("host", host).Bool("passthroughLearned", learned).Err(err).Msg("network-debugger: MITM handshake refused by client")
+	}
+}
+
+// clientRefusedCert reports whether the client ended the handshake itself: a TLS alert
+// (bad/unknown certificate) or closing the connection.
+func clientRefusedCert(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// splitConnectTarget returns the lower-cased host and the port (443 when absent) of a CONNECT target.
+func splitConnectTarget(hostport string) (string, int) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.ToLower(strings.Trim(hostport, "[]")), 443
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		port = 443
+	}
+	return strings.ToLower(host), port
+}
+
+// handleV1MITMRules manages the interception rules:
+// GET lists them; PUT replaces all ({"items": […]}) or, with ?id=…, one rule; POST appends one;
+// DELETE ?id=… removes one.
+func (d *Deps) handleV1MITMRules(w http.ResponseWriter, r *http.Request) {
+	serveRuleList(w, r, &d.Intercept.rules, "rule")
+}
+
+// handleV1MITMPassthrough lists the hosts learned to be pinned (GET) and forgets them so they are
+// intercepted again (DELETE ?host=…, without host: all).
+func (d *Deps) handleV1MITMPassthrough(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		host := r.URL.Query().Get("host")
+		if !d.Intercept.forget(host) && host != "" {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "host not learned", map[string]any{"host": host})
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET or DELETE", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": d.Intercept.Learned()})
+}
@@ -0,0 +1,152 @@
+package httpapi
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+// leafCache is a bounded LRU of issued leaf certificates keyed by host.
+type leafCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // front = most recently used
+	items map[string]*list.Element
+}
+
+type leafEntry struct {
+	host string
+	cert tls.Certificate
+}
+
+func newLeafCache(max int) *leafCache {
+	return &leafCache{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns the cached certificate for host unless it expires before validUntil
+// (such entries are dropped so the caller issues a fresh one).
+func (c *leafCache) get(host string, validUntil time.Time) (tls.Certificate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[host]
+	if !ok {
+		return tls.Certificate{}, false
+	}
+	e := el.Value.(*leafEntry)
+	if e.cert.Leaf == nil || e.cert.Leaf.NotAfter.Before(validUntil) {
+		c.order.Remove(el)
+		delete(c.items, host)
+		return tls.Certificate{}, false
+	}
+	c.order.MoveToFront(el)
+	return e.cert, true
+}
+
+func (c *leafCache) put(host string, cert tls.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[host]; ok {
+		el.Value.(*leafEntry).cert = cert
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[host] = c.order.PushFront(&leafEntry{host: host, cert: cert})
+	for c.order.Len() > c.max {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*leafEntry).host)
+	}
+}
+
+// singleflight runs one issuance per key at a time; callers arriving meanwhile get its result.
+type singleflight struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	wg   sync.WaitGroup
+	cert tls.Certificate
+	err  error
+}
+
+func (g *singleflight) do(key string, fn func() (tls.Certificate, error)) (tls.Certificate, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	if f, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		f.wg.Wait()
+		return f.cert, f.err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	f.cert, f.err = fn()
+	f.wg.Done()
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return f.cert, f.err
+}
+
+// leafKeyPool hands out a small fixed set of leaf keys round-robin, so only the first few
+// issuances pay for key generation.
+type leafKeyPool struct {
+	mu       sync.Mutex
+	keys     []crypto.Signer
+	next     int
+	generate func() (crypto.Signer, error)
+	// warm is closed once the background generation of keys[0] has finished
+	warm chan struct{}
+}
+
+func newLeafKeyPool(size int, generate func() (crypto.Signer, error)) *leafKeyPool {
+	if size <= 0 {
+		size = 1
+	}
+	p := &leafKeyPool{keys: make([]crypto.Signer, size), generate: generate, warm: make(chan struct{})}
+	// have the first key ready before the first handshake; get waits for it instead of
+	// generating slot 0 a second time
+	go func() {
+		defer close(p.warm)
+		if k, err := generate(); err == nil {
+			p.mu.Lock()
+			p.keys[0] = k
+			p.mu.Unlock()
+		}
+	}()
+	return p
+}
+
+func (p *leafKeyPool) get() (crypto.Signer, error) {
+	p.mu.Lock()
+	i := p.next
+	p.next = (p.next + 1) % len(p.keys)
+	p.mu.Unlock()
+	if i == 0 {
+		<-p.warm
+	}
+	p.mu.Lock()
+	k := p.keys[i]
+	p.mu.Unlock()
+	if k != nil {
+		return k, nil
+	}
+	k, err := p.generate()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	if p.keys[i] == nil {
+		p.keys[i] = k
+	}
+	k = p.keys[i]
+	p.mu.Unlock()
+	return k, nil
+}
@@ -3,6 +3,7 @@ package httpapi
 import (
     "errors"
     "sync"
+    "time"
     "github.com/gorilla/websocket"
 )
 
@@ -17,6 +18,8 @@ type liveWS struct {
     upstream *websocket.Conn
     // один writer в gorilla/websocket
     writeMu  sync.Mutex
+    // done закрывается при Unregister/CloseAll (будит пайпы, ждущие решения по брейкпоинту)
+    done     chan struct{}
 }
 
 func NewLiveSessions() *LiveSessions {
@@ -26,23 +29,38 @@ func NewLiveSessions() *LiveSessions {
 func (ls *LiveSessions) Register(sessionID string, client, upstream *websocket.Conn) {
     if sessionID == "" { return }
     ls.mu.Lock()
-    ls.m[sessionID] = &liveWS{client: client, upstream: upstream}
+    ls.m[sessionID] = &liveWS{client: client, upstream: upstream, done: make(chan struct{})}
     ls.mu.Unlock()
 }
 
 func (ls *LiveSessions) Unregister(sessionID string) {
     if sessionID == "" { return }
     ls.mu.Lock()
+    if w := ls.m[sessionID]; w != nil { close(w.done) }
     delete(ls.m, sessionID)
     ls.mu.Unlock()
 }
 
+// Done возвращает канал, закрываемый при завершении сессии (закрытый — для неизвестных сессий).
+func (ls *LiveSessions) Done(sessionID string) <-chan struct{} {
+    ls.mu.RLock()
+    w := ls.m[sessionID]
+    ls.mu.RUnlock()
+    if w == nil {
+        ch := make(chan struct{})
+        close(ch)
+        return ch
+    }
+    return w.done
+}
+
 // CloseAll закрывает все активные WS-сессии (клиент и апстрим), очищая карту.
 func (ls *LiveSessions) CloseAll() {
     ls.mu.Lock()
     for id, w := range ls.m {
         if w.client != nil { _ = w.client.Close() }
         if w.upstream != nil { _ = w.upstream.Close() }
+        close(w.done)
         delete(ls.m, id)
     }
     ls.mu.Unlock()
@@ -51,25 +69,60 @@ func (ls *LiveSessions) CloseAll() {
 // SendText отправляет текстовый фрейм в заданном направлении.
 // direction: "client->upstream" или "upstream->client".
 func (ls *LiveSessions) SendText(sessionID string, direction string, payload string) error {
+    return ls.Send(sessionID, direction, websocket.TextMessage, []byte(payload))
+}
+
+// Send отправляет фрейм типа mt (text, binary, ping, pong) в заданном направлении.
+func (ls *LiveSessions) Send(sessionID string, direction string, mt int, payload []byte) error {
+    w, conn, err := ls.target(sessionID, direction)
+    if err != nil { return err }
+    w.writeMu.Lock()
+    defer w.writeMu.Unlock()
+    switch mt {
+    case websocket.PingMessage, websocket.PongMessage:
+        return conn.WriteControl(mt, payload, time.Now().Add(5*time.Second))
+    default:
+        _ = conn.SetWriteDeadline(time.Now().Add(15 * time.Second))
+        return conn.WriteMessage(mt, payload)
+    }
+}
+
+// SendClose отправляет close-фрейм с кодом и причиной; сессия закрывается, когда пир ответит.
+func (ls *LiveSessions) SendClose(sessionID string, direction string, code int, reason string) error {
+    w, conn, err := ls.target(sessionID, direction)
+    if err != nil { return err }
+    w.writeMu.Lock()
+    defer w.writeMu.Unlock()
+    return conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(5*time.Second))
+}
+
+// WriteMessage пишет проксируемый фрейм в conn под тем же мьютексом, что и инжекты
+// (gorilla/websocket допускает одного писателя); для незарегистрированных сессий пишет напрямую.
+func (ls *LiveSessions) WriteMessage(sessionID string, conn *websocket.Conn, mt int, data []byte) error {
     ls.mu.RLock()
     w := ls.m[sessionID]
     ls.mu.RUnlock()
-    if w == nil { return errors.New("session not found or closed") }
-    switch direction {
-    case "client->upstream":
-        if w.upstream == nil { return errors.New("upstream not available") }
+    if w != nil {
         w.writeMu.Lock()
         defer w.writeMu.Unlock()
-        return w.upstream.WriteMessage(websocket.TextMessage, []byte(payload))
+    }
+    _ = conn.SetWriteDeadline(time.Now().Add(15 * time.Second))
+    return conn.WriteMessage(mt, data)
+}
+
+func (ls *LiveSessions) target(sessionID string, direction string) (*liveWS, *websocket.Conn, error) {
+    ls.mu.RLock()
+    w := ls.m[sessionID]
+    ls.mu.RUnlock()
+    if w == nil { return nil, nil, errors.New("session not found or closed") }
+    switch direction {
+    case "client->upstream":
+        if w.upstream == nil { return nil, nil, errors.New("upstream not available") }
+        return w, w.upstream, nil
     case "upstream->client":
-        if w.client == nil { return errors.New("client not available") }
-        w.writeMu.Lock()
-        defer w.writeMu.Unlock()
-        return w.client.WriteMessage(websocket.TextMessage, []byte(payload))
+        if w.client == nil { return nil, nil, errors.New("client not available") }
+        return w, w.client, nil
     default:
-        return errors.New("invalid direction")
+        return nil, nil, errors.New("invalid direction")
     }
 }
-
-
-
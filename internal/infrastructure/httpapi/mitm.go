@@ -1,6 +1,9 @@
 package httpapi
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
@@ -19,17 +22,26 @@ import (
 )
 
 // CertAuthority encapsulates CA loading and issuing short-lived certificates for domains.
+// CA keys may be RSA or ECDSA; leaf keys use the same algorithm (ECDSA leaves are P-256).
 type CertAuthority struct {
 	caCert  *x509.Certificate
-	caKey   *rsa.PrivateKey
+	caKey   crypto.Signer
 	tlsCert tls.Certificate
-	mu      sync.Mutex
-	// simple cache to avoid generating certificates for every request
-	cache map[string]tls.Certificate
+	// leaves caches issued certificates (LRU, re-issued before they expire)
+	leaves *leafCache
+	// keys is the pool of leaf keys shared by issued certificates
+	keys *leafKeyPool
+	// issuing deduplicates concurrent issuance for the same host
+	issuing singleflight
 	// issued certificates validity period
 	leafTTL time.Duration
 }
 
+const (
+	defaultLeafCacheSize = 1024
+	defaultLeafKeys      = 4
+)
+
 func LoadCertAuthority(caCertPath, caKeyPath string) (*CertAuthority, error) {
 	certPEM, err := os.ReadFile(caCertPath)
 	if err != nil {
@@ -39,6 +51,11 @@ func LoadCertAuthority(caCertPath, caKeyPath string) (*CertAuthority, error) {
 	if err != nil {
 		return nil, err
 	}
+	return LoadCertAuthorityFromPEM(certPEM, keyPEM)
+}
+
+// LoadCertAuthorityFromPEM loads CA from PEM content (without temporary files).
+func LoadCertAuthorityFromPEM(certPEM, keyPEM []byte) (*CertAuthority, error) {
 	block, _ := pem.Decode(certPEM)
 	if block == nil || block.Type != "CERTIFICATE" {
 		return nil, errors.New("mitm: invalid CA certificate PEM")
@@ -51,87 +68,90 @@ func LoadCertAuthority(caCertPath, caKeyPath string) (*CertAuthority, error) {
 	if kblk == nil {
 		return nil, errors.New("mitm: invalid CA key PEM")
 	}
-	var caKey *rsa.PrivateKey
-	if kblk.Type == "RSA PRIVATE KEY" {
-		caKey, err = x509.ParsePKCS1PrivateKey(kblk.Bytes)
-		if err != nil {
-			return nil, err
-		}
-	} else if kblk.Type == "PRIVATE KEY" {
-		pk, err := x509.ParsePKCS8PrivateKey(kblk.Bytes)
-		if err != nil {
-			return nil, err
-		}
-		var ok bool
-		caKey, ok = pk.(*rsa.PrivateKey)
-		if !ok {
-			return nil, errors.New("mitm: only RSA keys are supported for CA")
-		}
-	} else {
-		return nil, errors.New("mitm: unknown CA key PEM block type")
+	caKey, err := parseCAKey(kblk)
+	if err != nil {
+		return nil, err
 	}
 	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
 	if err != nil {
 		return nil, err
 	}
-	return &CertAuthority{
-		caCert:  caCert,
-		caKey:   caKey,
-		tlsCert: tlsCert,
-		cache:   make(map[string]tls.Certificate),
-		leafTTL: 24 * time.Hour,
-	}, nil
+	ca := &CertAuthority{caCert: caCert, caKey: caKey, tlsCert: tlsCert, leaves: newLeafCache(defaultLeafCacheSize), leafTTL: 24 * time.Hour}
+	ca.keys = newLeafKeyPool(defaultLeafKeys, ca.generateLeafKey)
+	return ca, nil
 }
 
-// LoadCertAuthorityFromPEM loads CA from PEM content (without temporary files).
-func LoadCertAuthorityFromPEM(certPEM, keyPEM []byte) (*CertAuthority, error) {
-	block, _ := pem.Decode(certPEM)
-	if block == nil || block.Type != "CERTIFICATE" {
-		return nil, errors.New("mitm: invalid CA certificate PEM")
-	}
-	caCert, err := x509.ParseCertificate(block.Bytes)
+// Certificate returns the CA certificate.
+func (ca *CertAuthority) Certificate() *x509.Certificate { return ca.caCert }
+
+// CertPEM returns the CA certificate as PEM.
+func (ca *CertAuthority) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})
+}
+
+// KeyPEM returns the CA private key as PEM (PKCS#1 for RSA, SEC 1 for ECDSA).
+func (ca *CertAuthority) KeyPEM() ([]byte, error) {
+	blk, err := marshalKeyPEM(ca.caKey)
 	if err != nil {
 		return nil, err
 	}
-	kblk, _ := pem.Decode(keyPEM)
-	if kblk == nil {
-		return nil, errors.New("mitм: некорректный PEM ключа CA")
-	}
-	var caKey *rsa.PrivateKey
-	if kblk.Type == "RSA PRIVATE KEY" {
-		caKey, err = x509.ParsePKCS1PrivateKey(kblk.Bytes)
-		if err != nil {
-			return nil, err
-		}
-	} else if kblk.Type == "PRIVATE KEY" {
+	return pem.EncodeToMemory(blk), nil
+}
+
+// parseCAKey accepts PKCS#1 RSA, SEC 1 EC and PKCS#8 (RSA or ECDSA) keys.
+func parseCAKey(kblk *pem.Block) (crypto.Signer, error) {
+	switch kblk.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(kblk.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(kblk.Bytes)
+	case "PRIVATE KEY":
 		pk, err := x509.ParsePKCS8PrivateKey(kblk.Bytes)
 		if err != nil {
 			return nil, err
 		}
-		var ok bool
-		caKey, ok = pk.(*rsa.PrivateKey)
-		if !ok {
-			return nil, errors.New("mitm: only RSA keys are supported for CA")
+		switch k := pk.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case *ecdsa.PrivateKey:
+			return k, nil
 		}
-	} else {
+		return nil, errors.New("mitm: only RSA and ECDSA keys are supported for CA")
+	default:
 		return nil, errors.New("mitm: unknown CA key PEM block type")
 	}
-	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
-	if err != nil {
-		return nil, err
+}
+
+// generateLeafKey creates a leaf key matching the CA key algorithm.
+func (ca *CertAuthority) generateLeafKey() (crypto.Signer, error) {
+	if _, ok := ca.caKey.(*ecdsa.PrivateKey); ok {
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	}
-	return &CertAuthority{caCert: caCert, caKey: caKey, tlsCert: tlsCert, cache: make(map[string]tls.Certificate), leafTTL: 24 * time.Hour}, nil
+	return rsa.GenerateKey(rand.Reader, 2048)
 }
 
 // GenerateDevCA generates self-signed root CA (RSA) for development.
 func GenerateDevCA(commonName string, yearsValid int) (certPEM, keyPEM []byte, err error) {
-	if yearsValid <= 0 {
-		yearsValid = 5
-	}
 	key, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return nil, nil, err
 	}
+	return generateDevCA(commonName, yearsValid, key, x509.KeyUsageKeyEncipherment)
+}
+
+// GenerateDevCAECDSA generates self-signed root CA with a P-256 key for development.
+func GenerateDevCAECDSA(commonName string, yearsValid int) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return generateDevCA(commonName, yearsValid, key, 0)
+}
+
+func generateDevCA(commonName string, yearsValid int, key crypto.Signer, usage x509.KeyUsage) (certPEM, keyPEM []byte, err error) {
+	if yearsValid <= 0 {
+		yearsValid = 5
+	}
 	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
 		return nil, nil, err
@@ -142,22 +162,41 @@ func GenerateDevCA(commonName string, yearsValid int) (certPEM, keyPEM []byte, e
 		Subject:               pkix.Name{CommonName: commonName},
 		NotBefore:             now,
 		NotAfter:              now.AddDate(yearsValid, 0, 0),
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		KeyUsage:              usage | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 		SubjectKeyId:          []byte{1, 2, 3, 4, 5, 6},
 	}
-	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBlock, err := marshalKeyPEM(key)
 	if err != nil {
 		return nil, nil, err
 	}
 	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
-	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
-	return certPEM, keyPEM, nil
+	return certPEM, pem.EncodeToMemory(keyBlock), nil
 }
 
-// IssueFor issues or takes from cache a certificate for sni/host.
+// marshalKeyPEM encodes RSA keys as PKCS#1 and ECDSA keys as SEC 1.
+func marshalKeyPEM(key crypto.Signer) (*pem.Block, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}, nil
+	}
+	return nil, errors.New("mitm: unsupported key type")
+}
+
+// IssueFor issues or takes from cache a certificate for sni/host. Cached certificates are
+// re-issued once they get close to expiry; concurrent calls for one host share one issuance.
 func (ca *CertAuthority) IssueFor(host string) (tls.Certificate, error) {
 	h := strings.TrimSpace(host)
 	if h == "" {
@@ -169,15 +208,23 @@ func (ca *CertAuthority) IssueFor(host string) (tls.Certificate, error) {
 			h = v
 		}
 	}
-	ca.mu.Lock()
-	if cert, ok := ca.cache[h]; ok {
-		ca.mu.Unlock()
+	h = strings.ToLower(h)
+	// refresh when less than a tenth of the validity is left
+	if cert, ok := ca.leaves.get(h, time.Now().Add(ca.leafTTL/10)); ok {
 		return cert, nil
 	}
-	ca.mu.Unlock()
+	return ca.issuing.do(h, func() (tls.Certificate, error) {
+		leaf, err := ca.issue(h)
+		if err == nil {
+			ca.leaves.put(h, leaf)
+		}
+		return leaf, err
+	})
+}
 
-	// Generate key and certificate for specific host
-	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// issue signs a new leaf certificate for h with a key from the pool.
+func (ca *CertAuthority) issue(h string) (tls.Certificate, error) {
+	leafKey, err := ca.keys.get()
 	if err != nil {
 		return tls.Certificate{}, err
 	}
@@ -185,13 +232,17 @@ func (ca *CertAuthority) IssueFor(host string) (tls.Certificate, error) {
 	if err != nil {
 		return tls.Certificate{}, err
 	}
+	usage := x509.KeyUsageDigitalSignature
+	if _, ok := leafKey.(*rsa.PrivateKey); ok {
+		usage |= x509.KeyUsageKeyEncipherment
+	}
 	now := time.Now().Add(-5 * time.Minute)
 	tmpl := &x509.Certificate{
 		SerialNumber:          serial,
 		Subject:               pkix.Name{CommonName: h},
 		NotBefore:             now,
 		NotAfter:              now.Add(ca.leafTTL),
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:              usage,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 		DNSNames:              []string{h},
@@ -202,32 +253,46 @@ func (ca *CertAuthority) IssueFor(host string) (tls.Certificate, error) {
 		tmpl.DNSNames = nil
 		tmpl.Subject = pkix.Name{CommonName: ip.String()}
 	}
-	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.caCert, &leafKey.PublicKey, ca.caKey)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.caCert, leafKey.Public(), ca.caKey)
 	if err != nil {
 		return tls.Certificate{}, err
 	}
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(leafKey)})
-	leaf, err := tls.X509KeyPair(append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})...), keyPEM)
+	cert, err := x509.ParseCertificate(der)
 	if err != nil {
 		return tls.Certificate{}, err
 	}
-	ca.mu.Lock()
-	ca.cache[h] = leaf
-	ca.mu.Unlock()
-	return leaf, nil
+	return tls.Certificate{Certificate: [][]byte{der, ca.caCert.Raw}, PrivateKey: leafKey, Leaf: cert}, nil
 }
 
 // MITM config and domain checks.
 type MITM struct {
+	// CA issues leaf certificates; swapped at runtime (generate / rotation) under mu,
+	// so read it through Authority once the proxy is serving.
 	CA          *CertAuthority
 	AllowSuffix []string
 	DenySuffix  []string
+	mu          sync.RWMutex
+}
+
+// Authority returns the CA currently issuing leaf certificates (nil when none).
+func (m *MITM) Authority() *CertAuthority {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.CA
+}
+
+func (m *MITM) setAuthority(ca *CertAuthority) {
+	m.mu.Lock()
+	m.CA = ca
+	m.mu.Unlock()
 }
 
 // shouldIntercept decides whether to intercept domain based on allow/deny lists.
 func (m *MITM) shouldIntercept(host string) bool {
-	if m == nil || m.CA == nil {
+	if m.Authority() == nil {
 		return false
 	}
 	h := host
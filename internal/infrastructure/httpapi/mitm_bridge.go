@@ -0,0 +1,268 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"network-debugger/internal/adapters/decoders/wsframe"
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// mitmTunnel is one intercepted CONNECT tunnel; every exchange inside it becomes its own session
+// (linked by tunnelId) through the shared capture pipeline.
+type mitmTunnel struct {
+	id         string
+	host       string // upstream host:port from CONNECT (or the SNI)
+	clientAddr string
+	via        string // "mitm" (CONNECT, SOCKS) | "transparent"
+	// dialAddr pins the upstream ip:port (transparent listener); empty resolves host as usual
+	dialAddr string
+	// user is the authenticated proxy user the tunnel's sessions are attributed to; clientID
+	// the client that opened the tunnel
+	user     string
+	clientID string
+	// clientProto is the ALPN protocol negotiated with the client ("h2" or "http/1.1")
+	clientProto string
+	// streams maps h2 requests to their stream ids (nil for HTTP/1.1 clients)
+	streams *h2StreamTracker
+}
+
+func newMITMTunnel(host, remoteAddr, via string) *mitmTunnel {
+	return &mitmTunnel{id: id.New(), host: host, clientAddr: clientHost(remoteAddr), via: via}
+}
+
+// context is the base context of the tunnel's requests; it carries the proxy user and the
+// pinned upstream address.
+func (t *mitmTunnel) context() context.Context {
+	ctx := withProxyUser(context.Background(), t.user)
+	if t.dialAddr == "" {
+		return ctx
+	}
+	return withPinnedDial(ctx, t.host, t.dialAddr)
+}
+
+// upstreamURL returns the https URL of path on the tunnel host (default port omitted).
+func (t *mitmTunnel) upstreamURL(u *url.URL) url.URL {
+	out := *u
+	out.Scheme = "https"
+	out.Host = t.host
+	if h, port, err := net.SplitHostPort(t.host); err == nil && port == "443" {
+		out.Host = h
+	}
+	return out
+}
+
+// serveMITMTunnel serves the decrypted client connection until it closes: h2 clients get an
+// http2.Server (one handler per stream, streams run concurrently), HTTP/1.1 clients a
+// single-connection http.Server. Both hand each request to handleMITMRequest.
+func (d *Deps) serveMITMTunnel(conn net.Conn, tun *mitmTunnel) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { d.handleMITMRequest(w, r, tun) })
+	ctx := tun.context()
+	if tun.clientProto == http2.NextProtoTLS {
+		tun.streams = newH2StreamTracker()
+		(&http2.Server{}).ServeConn(&h2TrackedConn{Conn: conn, t: tun.streams}, &http2.ServeConnOpts{Context: ctx, Handler: h})
+		_ = conn.Close()
+		return
+	}
+	ln := newSingleConnListener(conn)
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 60 * time.Second, BaseContext: func(net.Listener) context.Context { return ctx }}
+	_ = srv.Serve(ln)
+}
+
+// handleMITMRequest captures one decrypted request (an h2 stream or an HTTP/1.1 exchange).
+func (d *Deps) handleMITMRequest(w http.ResponseWriter, r *http.Request, tun *mitmTunnel) {
+	if tun.streams == nil && isWebSocketRequest(r) {
+		d.relayMITMUpgrade(w, r, tun)
+		return
+	}
+	upstream := tun.upstreamURL(r.URL)
+	d.captureHTTP(w, r, exchange{
+		upstream:       &upstream,
+		host:           r.Host,
+		via:            tun.via,
+		tunnelID:       tun.id,
+		streamID:       tun.streams.take(r.Method, r.Host, r.RequestURI),
+		forwardedProto: "https",
+		clientID:       tun.clientID,
+	})
+}
+
+// relayMITMUpgrade forwards a WebSocket upgrade over a dedicated upstream connection and, after
+// 101, relays the connection unchanged while decoding it into a "ws" session.
+func (d *Deps) relayMITMUpgrade(w http.ResponseWriter, r *http.Request, tun *mitmTunnel) {
+	u := tun.upstreamURL(r.URL)
+	u.Scheme = "wss"
+	sessionID := id.New()
+	_ = d.Svc.Create(contextWithNoCancel(), domain.Session{ID: sessionID, Target: u.String(), ClientAddr: tun.clientAddr, StartedAt: time.Now().UTC(), Kind: "ws", Via: tun.via, TunnelID: tun.id, User: tun.user, ClientID: tun.clientID})
+	d.Monitor.Broadcast(MonitorEvent{Type: "session_started", ID: sessionID})
+	d.Metrics.ActiveSessions.Inc()
+	var closeErr error
+	defer func() {
+		var errPtr *string
+		if closeErr != nil {
+			errPtr = strPtr(closeErr.Error())
+		}
+		_ = d.Svc.SetClosed(contextWithNoCancel(), sessionID, time.Now().UTC(), errPtr)
+		d.Monitor.Broadcast(MonitorEvent{Type: "session_ended", ID: sessionID})
+		d.Metrics.ActiveSessions.Dec()
+	}()
+	fail := func(err error) {
+		closeErr = err
+		d.recordTLSFailure(sessionID, err)
+		code, msg := humanizeProxyError(err)
+		writeError(w, http.StatusBadGateway, code, msg, map[string]any{"target": u.String(), "raw": err.Error()})
+	}
+
+	upstream, err := d.dialUpstreamTLS(r.Context(), "tcp", tun.host, []string{"http/1.1"})
+	if err == nil {
+		err = upstream.HandshakeContext(r.Context())
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer upstream.Close()
+	d.recordServerIP(sessionID, remoteIP(upstream))
+	d.recordClientCert(sessionID, clientCertOf(upstream))
+
+	out := r.Clone(r.Context())
+	out.URL.Scheme = "https"
+	out.URL.Host = tun.host
+	out.RequestURI = ""
+	if err := out.Write(upstream); err != nil {
+		fail(err)
+		return
+	}
+	upstreamBR := bufio.NewReader(upstream)
+	resp, err := http.ReadResponse(upstreamBR, out)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// keep the refused handshake visible in the session
+		rPrev := &http.Request{Method: out.Method, URL: out.URL, Header: out.Header}
+		for _, fr := range []domain.Frame{
+			{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionClientToUpstream, Opcode: domain.OpcodeText, Preview: buildHTTPRequestPreview(rPrev, nil)},
+			{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionUpstreamToClient, Opcode: domain.OpcodeText, Preview: buildHTTPResponsePreview(resp)},
+		} {
+			_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
+			d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
+		}
+		closeErr = errors.New("upstream refused websocket upgrade: " + resp.Status)
+		copyHeader(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+	client, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer client.Close()
+	if err := resp.Write(brw); err != nil || brw.Flush() != nil {
+		return
+	}
+	closeErr = d.relayMITMWebSocket(sessionID, resp, client, brw.Reader, upstream, upstreamBR)
+}
+
+// relayMITMWebSocket copies an upgraded WebSocket connection unchanged while decoding both
+// directions (RFC 6455 frames, permessage-deflate) into the "ws" session, like /wsproxy records.
+// It returns the copy error that ended the connection (nil on a clean close).
+func (d *Deps) relayMITMWebSocket(sessionID string, resp *http.Response, client net.Conn, clientBR io.Reader, upstream net.Conn, upstreamBR io.Reader) error {
+	deflate := wsframe.Negotiated(resp.Header.Get("Sec-WebSocket-Extensions"))
+	// the decoders run in the copying goroutines, so each direction records in stream order
+	var probed bool
+	decoder := func(dir domain.Direction) *wsframe.Decoder {
+		return wsframe.NewDecoder(deflate, func(m wsframe.Message) {
+			d.recordWSMessage(sessionID, dir, opcodeFromWire(m.Opcode), m.Data, m.Size, &probed)
+		})
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(upstream, io.TeeReader(clientBR, decoder(domain.DirectionClientToUpstream)))
+		_ = upstream.Close()
+		done <- err
+	}()
+	_, err := io.Copy(client, io.TeeReader(upstreamBR, decoder(domain.DirectionUpstreamToClient)))
+	_ = client.Close()
+	_ = upstream.Close()
+	if err2 := <-done; err == nil {
+		err = err2
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// opcodeFromWire maps an RFC 6455 opcode to the domain opcode.
+func opcodeFromWire(op byte) domain.Opcode {
+	switch op {
+	case wsframe.OpText:
+		return domain.OpcodeText
+	case wsframe.OpPing:
+		return domain.OpcodePing
+	case wsframe.OpPong:
+		return domain.OpcodePong
+	case wsframe.OpClose:
+		return domain.OpcodeClose
+	default:
+		return domain.OpcodeBinary
+	}
+}
+
+// singleConnListener hands one connection to http.Server; Accept then blocks until that
+// connection is closed (by the server or by a handler that hijacked it), so Serve returns
+// exactly when the tunnel is done.
+type singleConnListener struct {
+	ch     chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+	addr   net.Addr
+}
+
+func newSingleConnListener(c net.Conn) *singleConnListener {
+	l := &singleConnListener{ch: make(chan net.Conn, 1), closed: make(chan struct{}), addr: c.LocalAddr()}
+	l.ch <- &listenerConn{Conn: c, l: l}
+	return l
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.ch:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr { return l.addr }
+
+type listenerConn struct {
+	net.Conn
+	l *singleConnListener
+}
+
+func (c *listenerConn) Close() error {
+	err := c.Conn.Close()
+	_ = c.l.Close()
+	return err
+}
@@ -1,11 +1,40 @@
 package httpapi
 
 import (
-	"encoding/base64"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"time"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
 )
 
+// caInfoDTO describes a CA without its key.
+type caInfoDTO struct {
+	Subject     string    `json:"subject"`
+	Fingerprint string    `json:"fingerprint"` // SHA-256 of the certificate, hex
+	KeyType     string    `json:"keyType"`     // "rsa" | "ecdsa"
+	NotAfter    time.Time `json:"notAfter"`
+	// ActivateAt is set on a rotated-in CA that has not taken over yet
+	ActivateAt *time.Time `json:"activateAt,omitempty"`
+}
+
+func caInfo(ca *CertAuthority) *caInfoDTO {
+	if ca == nil {
+		return nil
+	}
+	c := ca.Certificate()
+	sum := sha256.Sum256(c.Raw)
+	keyType := "rsa"
+	if _, ok := ca.caKey.(*ecdsa.PrivateKey); ok {
+		keyType = "ecdsa"
+	}
+	return &caInfoDTO{Subject: c.Subject.String(), Fingerprint: hex.EncodeToString(sum[:]), KeyType: keyType, NotAfter: c.NotAfter}
+}
+
 // handleV1MITMStatus: GET returns current MITM config/status
 func (d *Deps) handleV1MITMStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -17,85 +46,226 @@ func (d *Deps) handleV1MITMStatus(w http.ResponseWriter, r *http.Request) {
 		HasCA   bool     `json:"hasCA"`
 		Allow   []string `json:"allow,omitempty"`
 		Deny    []string `json:"deny,omitempty"`
+		// CA is the CA issuing leaf certificates, Next the rotated-in CA waiting for activation
+		CA         *caInfoDTO `json:"ca,omitempty"`
+		Next       *caInfoDTO `json:"next,omitempty"`
+		Persistent bool       `json:"persistent"`
+	}
+	ca := d.MITM.Authority()
+	out := resp{Enabled: d.Cfg.MITMEnabled, HasCA: ca != nil, Allow: d.Cfg.MITMDomainsAllow, Deny: d.Cfg.MITMDomainsDeny, CA: caInfo(ca), Persistent: d.CAStore.Persistent()}
+	if next, at := d.CAStore.Pending(); next != nil {
+		out.Next = caInfo(next)
+		out.Next.ActivateAt = &at
 	}
-	out := resp{Enabled: d.Cfg.MITMEnabled, HasCA: d.MITM != nil && d.MITM.CA != nil, Allow: d.Cfg.MITMDomainsAllow, Deny: d.Cfg.MITMDomainsDeny}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(out)
 }
 
-// handleV1MITMGetCA: GET returns current CA certificate (PEM). If CA absent, 404.
+// handleV1MITMGetCA: GET downloads the CA certificate. If CA absent, 404.
+//
+//	?format=pem (default) | der | p12
+//	?which=current (default) | next (the rotated-in CA during its grace period)
+//	?includeKey=1 adds the private key (pem, p12 only); ?password= protects the p12
 func (d *Deps) handleV1MITMGetCA(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET", nil)
 		return
 	}
-	if d.MITM == nil || d.MITM.CA == nil || len(d.MITM.CA.tlsCert.Certificate) == 0 {
+	q := r.URL.Query()
+	var ca *CertAuthority
+	switch q.Get("which") {
+	case "", "current":
+		ca = d.MITM.Authority()
+	case "next":
+		ca, _ = d.CAStore.Pending()
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "which must be current or next", nil)
+		return
+	}
+	if ca == nil {
 		writeError(w, http.StatusNotFound, "NOT_FOUND", "no CA configured", nil)
 		return
 	}
-	// First cert in chain is leaf (root CA here)
-	w.Header().Set("Content-Type", "application/x-pem-file")
-	w.Header().Set("Content-Disposition", "attachment; filename=network-debugger-dev-ca.crt")
-	for _, b := range d.MITM.CA.tlsCert.Certificate {
-		// write all certs as PEM blocks
-		if len(b) == 0 {
-			continue
+	includeKey := q.Get("includeKey") == "1" || q.Get("includeKey") == "true"
+	name := "network-debugger-dev-ca"
+	switch q.Get("format") {
+	case "", "pem":
+		body := ca.CertPEM()
+		if includeKey {
+			keyPEM, err := ca.KeyPEM()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "CA_EXPORT_FAILED", err.Error(), nil)
+				return
+			}
+			body = append(body, keyPEM...)
+			name += "-with-key"
+		}
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", "attachment; filename="+name+".crt")
+		_, _ = w.Write(body)
+	case "der":
+		if includeKey {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "der carries the certificate only; use pem or p12 with includeKey", nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		w.Header().Set("Content-Disposition", "attachment; filename="+name+".cer")
+		_, _ = w.Write(ca.Certificate().Raw)
+	case "p12":
+		// legacy PBE: what Android and iOS certificate installers accept
+		var (
+			body []byte
+			err  error
+		)
+		if includeKey {
+			body, err = pkcs12.Legacy.Encode(ca.caKey, ca.Certificate(), nil, q.Get("password"))
+		} else {
+			body, err = pkcs12.Legacy.EncodeTrustStore([]*x509.Certificate{ca.Certificate()}, q.Get("password"))
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "CA_EXPORT_FAILED", err.Error(), nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-pkcs12")
+		w.Header().Set("Content-Disposition", "attachment; filename="+name+".p12")
+		_, _ = w.Write(body)
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "format must be pem, der or p12", nil)
+	}
+}
+
+// caRequest is the body of generate / rotate.
+type caRequest struct {
+	CN string `json:"cn"`
+	// KeyType is "rsa" (default) or "ecdsa" (P-256)
+	KeyType string `json:"keyType"`
+	// IncludeKey returns the private key PEM in the response
+	IncludeKey bool `json:"includeKey"`
+	// GraceSeconds (rotate only): how long the current CA keeps issuing; default MITM_CA_ROTATION_GRACE_HOURS
+	GraceSeconds *int `json:"graceSeconds"`
+}
+
+// newCA generates a CA as described by in; it writes the error response itself.
+func newCA(w http.ResponseWriter, in caRequest) *CertAuthority {
+	if in.CN == "" {
+		in.CN = "network-debugger dev CA"
+	}
+	generate := GenerateDevCA
+	switch in.KeyType {
+	case "", "rsa":
+	case "ecdsa":
+		generate = GenerateDevCAECDSA
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "keyType must be rsa or ecdsa", nil)
+		return nil
+	}
+	certPEM, keyPEM, err := generate(in.CN, 5)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "CA_GENERATE_FAILED", err.Error(), nil)
+		return nil
+	}
+	ca, err := LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "CA_GENERATE_FAILED", err.Error(), nil)
+		return nil
+	}
+	return ca
+}
+
+// writeCAResponse returns the certificate (and the key only when asked for).
+func writeCAResponse(w http.ResponseWriter, ca *CertAuthority, in caRequest, extra map[string]any) {
+	out := map[string]any{"certPEM": string(ca.CertPEM()), "ca": caInfo(ca)}
+	for k, v := range extra {
+		out[k] = v
+	}
+	if in.IncludeKey {
+		if keyPEM, err := ca.KeyPEM(); err == nil {
+			out["keyPEM"] = string(keyPEM)
 		}
-		_ = pemEncodeCert(w, b)
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
 }
 
-// handleV1MITMGenerate: POST generates a new dev CA in-memory; returns PEMs.
-// This is for convenience; in real conditions CA should be generated beforehand and stored securely.
+// handleV1MITMGenerate: POST generates a new CA and makes it current right away (no grace period).
+// The CA is persisted in MITM_CA_DIR when configured; the key is returned only with includeKey.
 func (d *Deps) handleV1MITMGenerate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use POST", nil)
 		return
 	}
-	var in struct {
-		CN string `json:"cn"`
+	var in caRequest
+	_ = json.NewDecoder(r.Body).Decode(&in)
+	ca := newCA(w, in)
+	if ca == nil {
+		return
+	}
+	if err := d.CAStore.Save(ca); err != nil {
+		writeError(w, http.StatusInternalServerError, "CA_PERSIST_FAILED", err.Error(), nil)
+		return
+	}
+	d.setMITMCA(ca)
+	writeCAResponse(w, ca, in, map[string]any{"persisted": d.CAStore.Persistent()})
+}
+
+// handleV1MITMRotate: POST generates the next CA. It is published immediately (download with
+// ?which=next) and takes over after the grace period, during which the current CA keeps issuing.
+func (d *Deps) handleV1MITMRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use POST", nil)
+		return
 	}
+	var in caRequest
 	_ = json.NewDecoder(r.Body).Decode(&in)
-	if in.CN == "" {
-		in.CN = "network-debugger dev CA"
+	if d.MITM.Authority() == nil {
+		writeError(w, http.StatusConflict, "NO_CA", "no CA to rotate; generate one first", nil)
+		return
 	}
-	certPEM, keyPEM, err := GenerateDevCA(in.CN, 5)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "CA_GENERATE_FAILED", err.Error(), nil)
+	grace := time.Duration(d.Cfg.MITMCARotationGraceHours) * time.Hour
+	if in.GraceSeconds != nil {
+		grace = time.Duration(*in.GraceSeconds) * time.Second
+	}
+	next := newCA(w, in)
+	if next == nil {
 		return
 	}
-	// swap runtime CA (in-memory only)
-	if ca, err2 := LoadCertAuthorityFromPEM(certPEM, keyPEM); err2 == nil {
-		if d.MITM == nil {
-			d.MITM = &MITM{}
+	if grace <= 0 {
+		if err := d.CAStore.Save(next); err != nil {
+			writeError(w, http.StatusInternalServerError, "CA_PERSIST_FAILED", err.Error(), nil)
+			return
 		}
-		d.MITM.CA = ca
+		d.setMITMCA(next)
+		writeCAResponse(w, next, in, map[string]any{"activateAt": time.Now().UTC()})
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"certPEM": string(certPEM), "keyPEM": string(keyPEM)})
+	activateAt := time.Now().Add(grace).UTC()
+	if err := d.CAStore.SetPending(next, activateAt); err != nil {
+		writeError(w, http.StatusInternalServerError, "CA_PERSIST_FAILED", err.Error(), nil)
+		return
+	}
+	d.CAStore.schedule(d.activatePendingCA)
+	writeCAResponse(w, next, in, map[string]any{"activateAt": activateAt})
 }
 
-// helper: write DER to PEM
-func pemEncodeCert(w http.ResponseWriter, der []byte) error {
-	_, err := w.Write([]byte("-----BEGIN CERTIFICATE-----\n"))
+// activatePendingCA switches issuance to the rotated-in CA once its grace period is over.
+func (d *Deps) activatePendingCA() {
+	ca, err := d.CAStore.Promote()
 	if err != nil {
-		return err
-	}
-	b := make([]byte, base64.StdEncoding.EncodedLen(len(der)))
-	base64.StdEncoding.Encode(b, der)
-	// wrap at 64 columns
-	for i := 0; i < len(b); i += 64 {
-		j := i + 64
-		if j > len(b) {
-			j = len(b)
-		}
-		if _, err := w.Write(b[i:j]); err != nil {
-			return err
-		}
-		if _, err := w.Write([]byte("\n")); err != nil {
-			return err
+		if d.Logger != nil {
+			d.Logger.Error().Err(err).Msg("network-debugger: MITM CA rotation failed")
 		}
+		return
+	}
+	if ca != nil {
+		d.setMITMCA(ca)
+	}
+}
+
+// setMITMCA swaps the CA issuing leaf certificates, enabling MITM when it was off.
+func (d *Deps) setMITMCA(ca *CertAuthority) {
+	if d.MITM == nil {
+		d.MITM = &MITM{CA: ca, AllowSuffix: d.Cfg.MITMDomainsAllow, DenySuffix: d.Cfg.MITMDomainsDeny}
+		return
 	}
-	_, err = w.Write([]byte("-----END CERTIFICATE-----\n"))
-	return err
+	d.MITM.setAuthority(ca)
 }
@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ProxyUsers maps usernames to passwords accepted in Proxy-Authorization (PROXY_USERS). When it
+// is empty the forward proxy, /httpproxy, /wsproxy and the SOCKS listener are open to everyone.
+type ProxyUsers map[string]string
+
+// ParseProxyUsers parses PROXY_USERS: "alice:secret,bob:hunter2".
+func ParseProxyUsers(s string) (ProxyUsers, error) {
+	out := ProxyUsers{}
+	var errs []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		user, pass, ok := strings.Cut(part, ":")
+		if !ok || user == "" || pass == "" {
+			errs = append(errs, "invalid entry (want user:password)")
+			continue
+		}
+		out[user] = pass
+	}
+	if len(errs) > 0 {
+		return out, errors.New(strings.Join(errs, "; "))
+	}
+	return out, nil
+}
+
+// valid reports whether user/pass is a configured account.
+func (u ProxyUsers) valid(user, pass string) bool {
+	want, ok := u[user]
+	if !ok {
+		// compare anyway so unknown users take as long as wrong passwords
+		want = pass + "x"
+	}
+	return subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1 && ok
+}
+
+// authorizeProxy checks Proxy-Authorization Basic credentials when PROXY_USERS is set and
+// answers 407 otherwise. It returns the authenticated user ("" when auth is off).
+func (d *Deps) authorizeProxy(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if len(d.ProxyUsers) == 0 {
+		return "", true
+	}
+	user, pass, ok := parseBasicAuth(r.Header.Get("Proxy-Authorization"))
+	if ok && d.ProxyUsers.valid(user, pass) {
+		return user, true
+	}
+	w.Header().Set("Proxy-Authenticate", `Basic realm="network-debugger"`)
+	writeError(w, http.StatusProxyAuthRequired, "PROXY_AUTH_REQUIRED", "proxy authentication required", nil)
+	return "", false
+}
+
+func parseBasicAuth(h string) (user, pass string, ok bool) {
+	const prefix = "basic "
+	if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(h[len(prefix):]))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(raw), ":")
+}
+
+type proxyUserKey struct{}
+
+// withProxyUser attributes the sessions created under ctx to user.
+func withProxyUser(ctx context.Context, user string) context.Context {
+	if user == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, proxyUserKey{}, user)
+}
+
+// proxyUser returns the authenticated proxy user of ctx ("" when none).
+func proxyUser(ctx context.Context) string {
+	u, _ := ctx.Value(proxyUserKey{}).(string)
+	return u
+}
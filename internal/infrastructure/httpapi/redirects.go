@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"network-debugger/internal/domain"
+)
+
+// RedirectTracker links redirects followed by clients: a 3xx Location seen for a client is
+// remembered for Window and matched against the next request of the same client to that URL.
+type RedirectTracker struct {
+	Window time.Duration
+
+	mu      sync.Mutex
+	pending map[string]pendingRedirect
+}
+
+type pendingRedirect struct {
+	sessionID string
+	chainID   string
+	expires   time.Time
+}
+
+func NewRedirectTracker(window time.Duration) *RedirectTracker {
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	return &RedirectTracker{Window: window, pending: map[string]pendingRedirect{}}
+}
+
+// redirectKey normalizes client + URL (no fragment, default ports dropped).
+func redirectKey(client string, u *url.URL) string {
+	v := *u
+	v.Fragment, v.RawFragment = "", ""
+	v.Scheme = strings.ToLower(v.Scheme)
+	v.Host = strings.ToLower(v.Host)
+	if h, p, err := net.SplitHostPort(v.Host); err == nil && ((v.Scheme == "http" && p == "80") || (v.Scheme == "https" && p == "443")) {
+		if strings.Contains(h, ":") {
+			h = "[" + h + "]"
+		}
+		v.Host = h
+	}
+	if v.Path == "" {
+		v.Path = "/"
+	}
+	v.ForceQuery = false
+	return client + "|" + v.String()
+}
+
+// Remember records that sessionID (part of chainID, may be empty) redirected client to location.
+func (t *RedirectTracker) Remember(client string, location *url.URL, sessionID, chainID string) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, p := range t.pending {
+		if now.After(p.expires) {
+			delete(t.pending, k)
+		}
+	}
+	t.pending[redirectKey(client, location)] = pendingRedirect{sessionID: sessionID, chainID: chainID, expires: now.Add(t.Window)}
+}
+
+// Take returns the redirecting session for a request of client to u and forgets it.
+func (t *RedirectTracker) Take(client string, u *url.URL) (sessionID, chainID string, ok bool) {
+	k := redirectKey(client, u)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, found := t.pending[k]
+	if !found {
+		return "", "", false
+	}
+	delete(t.pending, k)
+	if time.Now().After(p.expires) {
+		return "", "", false
+	}
+	return p.sessionID, p.chainID, true
+}
+
+// redirectLocation returns the resolved Location of a redirect response, or nil.
+func redirectLocation(reqURL *url.URL, status int, hdr http.Header) *url.URL {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil
+	}
+	loc := hdr.Get("Location")
+	if loc == "" || reqURL == nil {
+		return nil
+	}
+	u, err := reqURL.Parse(loc)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// linkRedirect marks s as the next hop of a chain when its client was just redirected to u.
+// The chain id is the id of the first hop, which is tagged retroactively.
+func (d *Deps) linkRedirect(s *domain.Session, u *url.URL) {
+	prev, chain, ok := d.Redirects.Take(s.ClientAddr, u)
+	if !ok {
+		return
+	}
+	if chain == "" {
+		chain = prev
+		d.setChainID(prev, chain)
+	}
+	s.ChainID, s.RedirectFrom = chain, prev
+}
+
+// noteRedirect remembers a redirect response of sessionID so the client's follow-up request is linked.
+func (d *Deps) noteRedirect(sessionID, client string, reqURL *url.URL, status int, hdr http.Header) {
+	loc := redirectLocation(reqURL, status, hdr)
+	if loc == nil {
+		return
+	}
+	chain := ""
+	if s, ok, _ := d.Svc.Get(contextWithNoCancel(), sessionID); ok {
+		chain = s.ChainID
+	}
+	d.Redirects.Remember(client, loc, sessionID, chain)
+}
+
+func (d *Deps) setChainID(sessionID, chainID string) {
+	_ = d.Svc.UpdateSession(contextWithNoCancel(), sessionID, func(s *domain.Session) {
+		if s.ChainID == "" {
+			s.ChainID = chainID
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// maxReplayCount caps "replay N times" so a typo cannot flood an upstream.
+const maxReplayCount = 100
+
+type replayRequestV1 struct {
+	// Headers overrides request headers; an empty value removes the header.
+	Headers map[string]string `json:"headers"`
+	// Body replaces the captured request body when set.
+	Body *string `json:"body"`
+	// Target replaces scheme and host of the original URL (e.g. "http://localhost:8080").
+	Target string `json:"target"`
+	// Count repeats the request sequentially (default 1).
+	Count int `json:"count"`
+}
+
+type replayRunV1 struct {
+	SessionID  string `json:"sessionId"`
+	Status     int    `json:"status"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+type replaySummaryV1 struct {
+	Count        int            `json:"count"`
+	Succeeded    int            `json:"succeeded"`
+	Failed       int            `json:"failed"`
+	MinMs        int64          `json:"minMs"`
+	MaxMs        int64          `json:"maxMs"`
+	AvgMs        int64          `json:"avgMs"`
+	StatusCounts map[string]int `json:"statusCounts"`
+}
+
+// handleV1Replay handles POST /_api/v1/sessions/{id}/replay.
+// The last HTTP transaction of the session is re-issued (method, URL, headers, spooled body)
+// and every run is recorded as a new session linked via replayOf.
+func (d *Deps) handleV1Replay(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use POST", nil)
+		return
+	}
+	var in replayRequestV1
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+			return
+		}
+	}
+	if in.Count == 0 {
+		in.Count = 1
+	}
+	if in.Count < 0 || in.Count > maxReplayCount {
+		writeError(w, http.StatusBadRequest, "BAD_VALUE", "count must be between 1 and "+strconv.Itoa(maxReplayCount), nil)
+		return
+	}
+	origSess, ok, _ := d.Svc.Get(r.Context(), sessionID)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "session not found", map[string]any{"id": sessionID})
+		return
+	}
+	txs, _, err := d.Svc.ListHTTPTransactions(r.Context(), sessionID, "", 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "HTTP_LIST_FAILED", err.Error(), map[string]any{"id": sessionID})
+		return
+	}
+	if len(txs) == 0 {
+		writeError(w, http.StatusConflict, "NOT_REPLAYABLE", "session has no captured http transaction", map[string]any{"id": sessionID})
+		return
+	}
+	orig := txs[len(txs)-1]
+
+	u, err := url.Parse(orig.URL)
+	if err != nil {
+		writeError(w, http.StatusConflict, "NOT_REPLAYABLE", "captured url is invalid", map[string]any{"url": orig.URL})
+		return
+	}
+	if in.Target != "" {
+		t, err := url.Parse(in.Target)
+		if err != nil || (t.Scheme != "http" && t.Scheme != "https") || t.Host == "" {
+			writeError(w, http.StatusBadRequest, "INVALID_TARGET", "invalid target", map[string]any{"target": in.Target})
+			return
+		}
+		u.Scheme = t.Scheme
+		u.Host = t.Host
+	}
+
+	var body []byte
+	switch {
+	case in.Body != nil:
+		body = []byte(*in.Body)
+	case orig.ReqBodyTruncated:
+		writeError(w, http.StatusConflict, "BODY_TRUNCATED", "captured request body exceeds BODY_MAX_BYTES; give a body override", map[string]any{"id": sessionID})
+		return
+	case orig.ReqBodyFile != "":
+		b, err := os.ReadFile(orig.ReqBodyFile)
+		if err != nil {
+			writeError(w, http.StatusConflict, "BODY_UNAVAILABLE", "captured body cannot be read", map[string]any{"raw": err.Error()})
+			return
+		}
+		body = b
+	case orig.ReqSize > 0:
+		writeError(w, http.StatusConflict, "BODY_NOT_CAPTURED", "request body was not captured (enable CAPTURE_BODIES) and no body override given", map[string]any{"id": sessionID})
+		return
+	}
+
+	hdr := http.Header{}
+	for k, vv := range orig.ReqHeaders {
+		hdr[k] = append([]string(nil), vv...)
+	}
+	removeHopHeaders(hdr)
+	hdr.Del("Content-Length")
+	for k, v := range in.Headers {
+		if v == "" {
+			hdr.Del(k)
+		} else {
+			hdr.Set(k, v)
+		}
+	}
+
+	runs := make([]replayRunV1, 0, in.Count)
+	sum := replaySummaryV1{Count: in.Count, StatusCounts: map[string]int{}}
+	var totalMs int64
+	for i := 0; i < in.Count; i++ {
+		req, err := http.NewRequestWithContext(r.Context(), orig.Method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			writeError(w, http.StatusConflict, "NOT_REPLAYABLE", err.Error(), nil)
+			return
+		}
+		req.Header = hdr.Clone()
+		req.ContentLength = int64(len(body))
+		if len(body) == 0 {
+			req.Body = http.NoBody
+		}
+		// a replay belongs to the client and user of the original exchange
+		sess := domain.Session{ID: id.New(), Target: u.String(), ClientAddr: clientHost(r.RemoteAddr), ReplayOf: sessionID, ClientID: origSess.ClientID, User: origSess.User}
+		res, err := d.issueCaptured(r.Context(), sess, req, body, issueOptions{})
+		run := replayRunV1{SessionID: res.SessionID, Status: res.Status, DurationMs: res.Tx.Timings.Total}
+		if err != nil {
+			run.Error = err.Error()
+		}
+		if err == nil && res.Status < http.StatusBadRequest {
+			sum.Succeeded++
+		} else {
+			sum.Failed++
+		}
+		if res.Status > 0 {
+			sum.StatusCounts[strconv.Itoa(res.Status)]++
+		}
+		if i == 0 || run.DurationMs < sum.MinMs {
+			sum.MinMs = run.DurationMs
+		}
+		if run.DurationMs > sum.MaxMs {
+			sum.MaxMs = run.DurationMs
+		}
+		totalMs += run.DurationMs
+		runs = append(runs, run)
+		if r.Context().Err() != nil {
+			break
+		}
+	}
+	if len(runs) > 0 {
+		sum.AvgMs = totalMs / int64(len(runs))
+	}
+	sum.Count = len(runs)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"replayOf": sessionID, "runs": runs, "summary": sum})
+}
@@ -22,6 +22,30 @@ type Deps struct {
 	Monitor *MonitorHub
 	Live    *LiveSessions
 	MITM    *MITM
+	// Upstream routes outbound connections through UPSTREAM_PROXY / UPSTREAM_PROXY_RULES (nil = environment proxies)
+	Upstream *UpstreamRouter
+	// DNS holds runtime-editable host overrides and the optional custom DNS server
+	DNS *DNSResolver
+	// ProxyUsers are the accounts accepted by the forward proxy, /httpproxy and SOCKS (PROXY_USERS)
+	ProxyUsers ProxyUsers
+	// Clients identifies devices and holds their names and settings (CLIENT_ID_SOURCES)
+	Clients *ClientRegistry
+	// TransparentDNS resolves SNI hosts for the transparent TLS listener (nil = DNS)
+	TransparentDNS *DNSResolver
+	// Transports is the shared keep-alive upstream transport pool
+	Transports *TransportPool
+	// ClientCerts are presented to upstreams requesting mutual TLS (UPSTREAM_CLIENT_CERTS, /_api/v1/client-certs)
+	ClientCerts *ClientCertStore
+	// Redirects links client-followed redirects into chains (REDIRECT_CHAIN_WINDOW_MS)
+	Redirects *RedirectTracker
+	// UpstreamTLS is the trust store (UPSTREAM_CA_BUNDLE) and per-host TLS policy (UPSTREAM_TLS_POLICIES)
+	UpstreamTLS *UpstreamTLS
+	// CAStore persists the MITM CA (MITM_CA_DIR) and its pending rotation
+	CAStore *CAStore
+	// Intercept holds the runtime MITM interception rules and the learned passthrough hosts
+	Intercept *InterceptPolicy
+	// WSBreakpoints holds /wsproxy messages matching runtime breakpoints until they are decided
+	WSBreakpoints *WSBreakpoints
 }
 
 func NewRouter(cfg config.Config, logger *zerolog.Logger, metrics *obs.Metrics) http.Handler {
@@ -52,6 +76,101 @@ func buildBaseMux(d *Deps) *http.ServeMux {
 	// Apply sensitive headers exposure flag
 	exposeSensitiveHeaders = d.Cfg.ExposeSensitiveHeaders
 	previewDecompress = d.Cfg.PreviewDecompress
+	if d.DNS == nil {
+		overrides, err := ParseDNSOverrides(d.Cfg.DNSOverrides)
+		if err == nil {
+			d.DNS, err = NewDNSResolver(d.Cfg.DNSServer, overrides)
+		} else {
+			d.DNS, _ = NewDNSResolver(d.Cfg.DNSServer, nil)
+		}
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: DNS config has invalid entries")
+		}
+	}
+	if d.ProxyUsers == nil && d.Cfg.ProxyUsers != "" {
+		var err error
+		d.ProxyUsers, err = ParseProxyUsers(d.Cfg.ProxyUsers)
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: PROXY_USERS has invalid entries")
+		}
+	}
+	if d.Clients == nil {
+		sources, err := ParseClientIDSources(d.Cfg.ClientIDSources)
+		if err != nil {
+			if d.Logger != nil {
+				d.Logger.Warn().Err(err).Msg("network-debugger: invalid CLIENT_ID_SOURCES, using header,user,ip")
+			}
+			sources, _ = ParseClientIDSources("")
+		}
+		d.Clients = NewClientRegistry(sources)
+	}
+	if d.TransparentDNS == nil && d.Cfg.TransparentDNSServer != "" {
+		var err error
+		d.TransparentDNS, err = NewDNSResolver(d.Cfg.TransparentDNSServer, nil)
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: invalid TRANSPARENT_DNS_SERVER")
+		}
+	}
+	if d.Upstream == nil {
+		up, err := ParseUpstreamRouter(d.Cfg.UpstreamProxy, d.Cfg.UpstreamProxyRules)
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: upstream proxy config has invalid entries")
+		}
+		d.Upstream = up
+	}
+	if d.Upstream.DNS == nil {
+		d.Upstream.DNS = d.DNS
+	}
+	if d.Redirects == nil {
+		d.Redirects = NewRedirectTracker(time.Duration(d.Cfg.RedirectChainWindowMs) * time.Millisecond)
+	}
+	if d.UpstreamTLS == nil {
+		roots, err := LoadCABundle(d.Cfg.UpstreamCABundle)
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: upstream CA bundle has invalid entries")
+		}
+		policies, err := ParseTLSPolicies(d.Cfg.UpstreamTLSPolicies)
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: upstream TLS policies have invalid entries")
+		}
+		d.UpstreamTLS = &UpstreamTLS{Roots: roots, InsecureAll: d.Cfg.InsecureTLS, Policies: policies}
+	}
+	if d.ClientCerts == nil {
+		certs, err := LoadClientCerts(d.Cfg.UpstreamClientCerts)
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: upstream client certificates have invalid entries")
+		}
+		d.ClientCerts = NewClientCertStore(certs)
+	}
+	if d.CAStore == nil {
+		d.CAStore = NewCAStore(d.Cfg.MITMCADir)
+		ca, err := d.CAStore.Load()
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: stored MITM CA could not be loaded")
+		}
+		// CA files from MITM_CA_CERT_FILE/MITM_CA_KEY_FILE take precedence over the stored one
+		if ca != nil && d.MITM.Authority() == nil {
+			d.setMITMCA(ca)
+		}
+		d.CAStore.schedule(d.activatePendingCA)
+	}
+	if d.Intercept == nil {
+		d.Intercept = NewInterceptPolicy()
+	}
+	if d.Live == nil {
+		d.Live = NewLiveSessions()
+	}
+	if d.WSBreakpoints == nil {
+		d.WSBreakpoints = NewWSBreakpoints()
+	}
+	if d.Transports == nil {
+		policies, err := ParseHostPolicies(d.Cfg.UpstreamHostPolicies)
+		if err != nil && d.Logger != nil {
+			d.Logger.Warn().Err(err).Msg("network-debugger: upstream host policies have invalid entries")
+		}
+		defaults := transportSettings{maxConnsPerHost: d.Cfg.UpstreamMaxConnsPerHost, maxIdleConnsPerHost: d.Cfg.UpstreamMaxIdleConnsPerHost}
+		d.Transports = NewTransportPool(d.buildTransport, defaults, policies)
+	}
 
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -78,7 +197,11 @@ func buildBaseMux(d *Deps) *http.ServeMux {
 	// Single handler for /api/sessions/* to avoid duplicate registrations
 	mux.HandleFunc("/api/sessions/", func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(r.URL.Path, "/ws/send") {
-			d.handleWSSendText(w, r)
+			d.handleWSSend(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/ws/emit") {
+			d.handleWSEmit(w, r)
 			return
 		}
 		d.handleSessionByID(w, r)
@@ -123,7 +246,12 @@ func buildBaseMux(d *Deps) *http.ServeMux {
 	mux.HandleFunc("/_api/v1/captures", d.handleV1Captures)
 	// Runtime settings (response delay, etc.)
 	mux.HandleFunc("/_api/v1/settings", d.handleV1Settings)
+	// DNS overrides / custom resolver for outbound dials
+	mux.HandleFunc("/_api/v1/dns", d.handleV1DNS)
+	mux.HandleFunc("/_api/v1/client-certs", d.handleV1ClientCerts)
 	mux.HandleFunc("/_api/v1/monitor/ws", d.Monitor.HandleWS)
+	// Request composer (debugger-issued requests, captured like proxied ones)
+	mux.HandleFunc("/_api/v1/compose", d.handleV1Compose)
 	mux.HandleFunc("/_api/v1/httpproxy", d.handleHTTPProxy)
 	mux.HandleFunc("/_api/v1/httpproxy/", d.handleHTTPProxy)
 
@@ -131,6 +259,16 @@ func buildBaseMux(d *Deps) *http.ServeMux {
 	mux.HandleFunc("/_api/v1/mitm/status", d.handleV1MITMStatus)
 	mux.HandleFunc("/_api/v1/mitm/ca", d.handleV1MITMGetCA)
 	mux.HandleFunc("/_api/v1/mitm/ca/generate", d.handleV1MITMGenerate)
+	mux.HandleFunc("/_api/v1/mitm/ca/rotate", d.handleV1MITMRotate)
+	mux.HandleFunc("/_api/v1/mitm/rules", d.handleV1MITMRules)
+	mux.HandleFunc("/_api/v1/mitm/passthrough", d.handleV1MITMPassthrough)
+	mux.HandleFunc("/_api/v1/clients", d.handleV1Clients)
+	// WebSocket breakpoints (/wsproxy) and the frames they hold
+	mux.HandleFunc("/_api/v1/ws/breakpoints", d.handleV1WSBreakpoints)
+	mux.HandleFunc("/_api/v1/ws/paused", d.handleV1WSPaused)
+	// Device setup: PAC file and proxy/CA details (JSON or QR code)
+	mux.HandleFunc("/proxy.pac", d.handleProxyPAC)
+	mux.HandleFunc("/setup", d.handleSetup)
 
 	return mux
 }
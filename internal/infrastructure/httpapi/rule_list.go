@@ -0,0 +1,173 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"network-debugger/pkg/shared/id"
+)
+
+// listedRule is implemented by the pointer type of the rules a ruleList holds.
+type listedRule[T any] interface {
+	*T
+	// compile validates the rule and prepares its matchers
+	compile() error
+	ruleID() string
+	setRuleID(string)
+}
+
+// ruleList is an ordered list of compiled rules addressed by id, evaluated first match wins. It
+// backs the MITM interception rules and the WebSocket breakpoints. Stored rules are never
+// modified: an update swaps in a new one, so a matched rule can be read without the lock.
+type ruleList[T any, P listedRule[T]] struct {
+	mu    sync.RWMutex
+	rules []P
+}
+
+// first returns the first rule match accepts, or nil.
+func (l *ruleList[T, P]) first(match func(P) bool) P {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, r := range l.rules {
+		if match(r) {
+			return r
+		}
+	}
+	return nil
+}
+
+// all returns a copy of the rules in evaluation order.
+func (l *ruleList[T, P]) all() []T {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := make([]T, 0, len(l.rules))
+	for _, r := range l.rules {
+		out = append(out, *r)
+	}
+	return out
+}
+
+// set validates and replaces all rules; ids are assigned where missing.
+func (l *ruleList[T, P]) set(rules []T) error {
+	compiled := make([]P, 0, len(rules))
+	for i := range rules {
+		rule := rules[i]
+		r := P(&rule)
+		if err := r.compile(); err != nil {
+			return err
+		}
+		if r.ruleID() == "" {
+			r.setRuleID(id.New())
+		}
+		compiled = append(compiled, r)
+	}
+	l.mu.Lock()
+	l.rules = compiled
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *ruleList[T, P]) add(rule T) error {
+	r := P(&rule)
+	if err := r.compile(); err != nil {
+		return err
+	}
+	r.setRuleID(id.New())
+	l.mu.Lock()
+	l.rules = append(l.rules, r)
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *ruleList[T, P]) update(rule T) (bool, error) {
+	r := P(&rule)
+	if err := r.compile(); err != nil {
+		return false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, cur := range l.rules {
+		if cur.ruleID() == r.ruleID() {
+			l.rules[i] = r
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (l *ruleList[T, P]) remove(ruleID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, r := range l.rules {
+		if r.ruleID() == ruleID {
+			l.rules = append(l.rules[:i], l.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// serveRuleList manages l over HTTP: GET lists the rules; PUT replaces all ({"items": […]}) or,
+// with ?id=…, one rule; POST appends one; DELETE ?id=… removes one. Every call answers with the
+// resulting list. noun names a rule in 404 messages.
+func serveRuleList[T any, P listedRule[T]](w http.ResponseWriter, r *http.Request, l *ruleList[T, P], noun string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if ruleID := r.URL.Query().Get("id"); ruleID != "" {
+			var in T
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+				return
+			}
+			P(&in).setRuleID(ruleID)
+			found, err := l.update(in)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "BAD_VALUE", err.Error(), nil)
+				return
+			}
+			if !found {
+				writeError(w, http.StatusNotFound, "NOT_FOUND", noun+" not found", map[string]any{"id": ruleID})
+				return
+			}
+			break
+		}
+		var in struct {
+			Items []T `json:"items"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+			return
+		}
+		if err := l.set(in.Items); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", err.Error(), nil)
+			return
+		}
+	case http.MethodPost:
+		var in T
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+			return
+		}
+		if err := l.add(in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", err.Error(), nil)
+			return
+		}
+	case http.MethodDelete:
+		ruleID := r.URL.Query().Get("id")
+		if ruleID == "" {
+			writeError(w, http.StatusBadRequest, "MISSING_ID", "missing id", nil)
+			return
+		}
+		if !l.remove(ruleID) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", noun+" not found", map[string]any{"id": ruleID})
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET, PUT, POST or DELETE", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": l.all()})
+}
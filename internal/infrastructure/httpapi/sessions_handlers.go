@@ -36,7 +36,7 @@ func (d *Deps) handleListSessions(w http.ResponseWriter, r *http.Request) {
 		limit = 50
 	}
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
-	f := usecase.SessionFilter{Q: q, Target: target, Limit: limit, Offset: offset}
+	f := usecase.SessionFilter{Q: q, Target: target, Limit: limit, Offset: offset, ChainID: r.URL.Query().Get("chainId"), User: r.URL.Query().Get("user"), ClientID: r.URL.Query().Get("clientId")}
 	items, total, err := d.Svc.List(r.Context(), f)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "SESSIONS_LIST_FAILED", err.Error(), nil)
@@ -108,6 +108,7 @@ func (d *Deps) handleSessionByID(w http.ResponseWriter, r *http.Request) {
 			Name        string    `json:"name"`
 			AckID       *int64    `json:"ackId,omitempty"`
 			ArgsPreview string    `json:"argsPreview"`
+			SSEID       string    `json:"sseId,omitempty"`
 		}
 		out := make([]evView, 0, len(events))
 		for _, e := range events {
@@ -119,6 +120,7 @@ func (d *Deps) handleSessionByID(w http.ResponseWriter, r *http.Request) {
 				Name:        e.Name,
 				AckID:       e.AckID,
 				ArgsPreview: e.ArgsPreview,
+				SSEID:       e.SSEID,
 			})
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -223,7 +225,7 @@ func (d *Deps) handleV1ListSessions(w http.ResponseWriter, r *http.Request) {
 	// For MVP we reuse offset-based List and synthesize a cursor as last id.
 	// A real cursor would be a stable token (e.g., startedAt+id).
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
-	f := usecase.SessionFilter{Q: q, Target: target, Limit: limit, Offset: offset}
+	f := usecase.SessionFilter{Q: q, Target: target, Limit: limit, Offset: offset, ChainID: r.URL.Query().Get("chainId"), User: r.URL.Query().Get("user"), ClientID: r.URL.Query().Get("clientId")}
 	// capture filters
 	capStr := r.URL.Query().Get("captureId")
 	if capStr != "" {
@@ -338,6 +340,8 @@ func (d *Deps) handleV1SessionByID(w http.ResponseWriter, r *http.Request) {
 		}
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]any{"items": events, "next": next})
+	case "replay":
+		d.handleV1Replay(w, r, id)
 	case "body":
 		// Placeholder: body storage not implemented in memory store => 404 with reason
 		w.Header().Set("Content-Type", "application/json")
@@ -803,6 +807,16 @@ func (d *Deps) handleSessionStream(w http.ResponseWriter, r *http.Request) {
 					last := txs[len(txs)-1:]
 					_ = writeSSE(w, flusher, "http", last, enc)
 				}
+			case "http_tx_updated":
+				// resend the transaction with final timings (same id; clients replace it)
+				if txs, _, _ := d.Svc.ListHTTPTransactions(r.Context(), id, "", 1<<30); len(txs) > 0 {
+					for i := range txs {
+						if txs[i].ID == ev.Ref {
+							_ = writeSSE(w, flusher, "http", txs[i:i+1], enc)
+							break
+						}
+					}
+				}
 			case "session_ended", "session_started":
 				_ = writeSSE(w, flusher, ev.Type, ev, enc)
 			}
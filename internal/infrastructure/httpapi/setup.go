@@ -0,0 +1,251 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// handleProxyPAC serves a proxy auto-config file that sends only the hosts the MITM policy
+// would intercept through the proxy; everything else goes DIRECT. It is generated per request
+// from the live policy (learned passthrough, the mitm setting of the client the PAC request is
+// identified as, rules matching the requesting client, MITM_DOMAINS_DENY/ALLOW), so devices pick
+// up changes on their next PAC refresh.
+func (d *Deps) handleProxyPAC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET", nil)
+		return
+	}
+	host, port := d.proxyEndpoint(r)
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-store")
+	clientID := d.Clients.identify(d.clientOfRequest(r))
+	_, _ = w.Write([]byte(d.proxyPAC(net.JoinHostPort(host, strconv.Itoa(port)), clientHost(r.RemoteAddr), clientID)))
+}
+
+// proxyPAC renders FindProxyForURL in the evaluation order of mitmDecision. Rules restricted to
+// a port or written as hostRegex cannot be expressed in PAC: a passthrough one is left out (the
+// proxy relays such hosts opaquely anyway), an intercept one sends every host not decided before
+// it through the proxy.
+func (d *Deps) proxyPAC(proxyAddr, client, clientID string) string {
+	var b strings.Builder
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  host = host.toLowerCase();\n")
+	b.WriteString("  var proxy = " + jsString("PROXY "+proxyAddr) + ";\n")
+	if d.Intercept != nil {
+		for _, e := range d.Intercept.Learned() {
+			b.WriteString("  if (host == " + jsString(e.Host) + ") return \"DIRECT\"; // pinned\n")
+		}
+		switch d.Clients.settings(clientID).MITM {
+		case "intercept":
+			b.WriteString("  return proxy;\n}\n")
+			return b.String()
+		case "passthrough":
+			b.WriteString("  return \"DIRECT\";\n}\n")
+			return b.String()
+		}
+		ip := net.ParseIP(client)
+		for _, rule := range d.Intercept.Rules() {
+			if rule.client != nil && (ip == nil || !rule.client.Contains(ip)) {
+				continue
+			}
+			if rule.Port != 0 || rule.HostRegex != "" {
+				if rule.Action == "passthrough" {
+					continue
+				}
+				b.WriteString("  return proxy; // port or hostRegex rule\n}\n")
+				return b.String()
+			}
+			ret := "proxy"
+			if rule.Action == "passthrough" {
+				ret = "\"DIRECT\""
+			}
+			cond := "true"
+			if rule.Host != "" {
+				cond = "shExpMatch(host, " + jsString(rule.Host) + ")"
+			}
+			b.WriteString("  if (" + cond + ") return " + ret + ";\n")
+		}
+	}
+	allow, deny := d.mitmDomainLists()
+	for _, s := range deny {
+		b.WriteString("  if (" + pacSuffixMatch(s) + ") return \"DIRECT\";\n")
+	}
+	if len(allow) == 0 {
+		b.WriteString("  return proxy;\n}\n")
+		return b.String()
+	}
+	for _, s := range allow {
+		b.WriteString("  if (" + pacSuffixMatch(s) + ") return proxy;\n")
+	}
+	b.WriteString("  return \"DIRECT\";\n}\n")
+	return b.String()
+}
+
+// mitmDomainLists returns the MITM_DOMAINS_ALLOW/DENY suffixes in effect.
+func (d *Deps) mitmDomainLists() (allow, deny []string) {
+	if d.MITM != nil {
+		allow, deny = d.MITM.AllowSuffix, d.MITM.DenySuffix
+	} else {
+		allow, deny = d.Cfg.MITMDomainsAllow, d.Cfg.MITMDomainsDeny
+	}
+	return trimSuffixes(allow), trimSuffixes(deny)
+}
+
+func trimSuffixes(in []string) []string {
+	var out []string
+	for _, s := range in {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// pacSuffixMatch mirrors MITM.shouldIntercept: exact host or plain suffix.
+func pacSuffixMatch(suffix string) string {
+	q := jsString(suffix)
+	return "host == " + q + " || dnsDomainIs(host, " + q + ")"
+}
+
+// jsString renders s as a JavaScript string literal; unlike strconv.Quote it never emits Go-only
+// escapes such as \a or \U0001F600.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+type setupProxyDTO struct {
+	Interface string `json:"interface"`
+	Host      string `json:"host"`
+	Port      int    `json:"port"`
+	PACURL    string `json:"pacUrl"`
+}
+
+type setupDTO struct {
+	// Proxies lists the proxy endpoint on every local interface address
+	Proxies []setupProxyDTO `json:"proxies"`
+	// PACURL and CAURL use the host the request reached the debugger on
+	PACURL    string `json:"pacUrl"`
+	CAURL     string `json:"caUrl,omitempty"`
+	HasCA     bool   `json:"hasCA"`
+	SOCKSPort int    `json:"socksPort,omitempty"`
+}
+
+// handleSetup returns what a device needs to use the debugger:
+//
+//	?format=json (default) — proxy host/port per local interface, PAC URL, CA download link
+//	?format=png — QR code of {"proxy","pac","ca"} for one host (?host=, default: the requested
+//	host); ?size= is the image width in pixels (default 320)
+func (d *Deps) handleSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET", nil)
+		return
+	}
+	reqHost, port := d.proxyEndpoint(r)
+	q := r.URL.Query()
+	hasCA := d.MITM.Authority() != nil
+	switch q.Get("format") {
+	case "", "json":
+		out := setupDTO{Proxies: []setupProxyDTO{}, PACURL: pacURL(reqHost, port), HasCA: hasCA, SOCKSPort: addrPort(d.Cfg.SOCKSAddr)}
+		if hasCA {
+			out.CAURL = caURL(reqHost, port)
+		}
+		for _, a := range localInterfaceAddrs() {
+			out.Proxies = append(out.Proxies, setupProxyDTO{Interface: a.iface, Host: a.ip, Port: port, PACURL: pacURL(a.ip, port)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	case "png":
+		host := reqHost
+		if h := q.Get("host"); h != "" {
+			host = strings.Trim(h, "[]")
+		}
+		size := 320
+		if v, err := strconv.Atoi(q.Get("size")); err == nil && v >= 64 && v <= 2048 {
+			size = v
+		}
+		payload := map[string]string{"proxy": net.JoinHostPort(host, strconv.Itoa(port)), "pac": pacURL(host, port)}
+		if hasCA {
+			payload["ca"] = caURL(host, port)
+		}
+		content, _ := json.Marshal(payload)
+		png, err := qrcode.Encode(string(content), qrcode.Medium, size)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "QR_FAILED", err.Error(), nil)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(png)
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "format must be json or png", nil)
+	}
+}
+
+// proxyEndpoint returns the host the client reached us on and the proxy port: the port of the
+// request's Host when present, else the ADDR port.
+func (d *Deps) proxyEndpoint(r *http.Request) (string, int) {
+	host, portStr, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, portStr = strings.Trim(r.Host, "[]"), ""
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		if port = addrPort(d.Cfg.Addr); port == 0 {
+			port = 80
+		}
+	}
+	return host, port
+}
+
+// addrPort returns the port of a listen address like ":9091" (0 when absent).
+func addrPort(addr string) int {
+	_, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(p)
+	return port
+}
+
+func pacURL(host string, port int) string {
+	return (&url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(port)), Path: "/proxy.pac"}).String()
+}
+
+func caURL(host string, port int) string {
+	return (&url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(port)), Path: "/_api/v1/mitm/ca", RawQuery: "format=pem"}).String()
+}
+
+type interfaceAddr struct{ iface, ip string }
+
+// localInterfaceAddrs lists the addresses of up, non-loopback interfaces (IPv4 and global IPv6).
+func localInterfaceAddrs() []interfaceAddr {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var out []interfaceAddr
+	for _, ifc := range ifaces {
+		if ifc.Flags&net.FlagUp == 0 || ifc.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := ifc.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipn, ok := a.(*net.IPNet)
+			if !ok || ipn.IP.IsLinkLocalUnicast() || ipn.IP.IsLoopback() {
+				continue
+			}
+			out = append(out, interfaceAddr{iface: ifc.Name, ip: ipn.IP.String()})
+		}
+	}
+	return out
+}
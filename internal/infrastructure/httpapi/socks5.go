@@ -0,0 +1,284 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"network-debugger/pkg/shared/id"
+)
+
+// SOCKS5 (RFC 1928) constants; username/password auth is RFC 1929.
+const (
+	socksVersion        = 0x05
+	socksAuthNone       = 0x00
+	socksAuthUserPass   = 0x02
+	socksAuthNoAccept   = 0xFF
+	socksCmdConnect     = 0x01
+	socksAtypIPv4       = 0x01
+	socksAtypDomain     = 0x03
+	socksAtypIPv6       = 0x04
+	socksRepSucceeded   = 0x00
+	socksRepFailure     = 0x01
+	socksRepNetUnreach  = 0x03
+	socksRepHostUnreach = 0x04
+	socksRepRefused     = 0x05
+	socksRepCmdUnsupp   = 0x07
+	socksRepAtypUnsupp  = 0x08
+)
+
+// socksHandshakeTimeout bounds the SOCKS negotiation; socksPeekTimeout is how long an
+// interceptable connection waits for the client to speak before it is tunneled as is.
+const (
+	socksHandshakeTimeout = 30 * time.Second
+	socksPeekTimeout      = 5 * time.Second
+)
+
+// ServeSOCKS5 accepts SOCKS5 clients on ln (SOCKS_ADDR) until ln is closed. CONNECT requests
+// reuse the forward-proxy machinery: port 80 is parsed as HTTP, TLS is intercepted when the MITM
+// policy allows it, anything else becomes a tunnel session with byte counters.
+func (d *Deps) ServeSOCKS5(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go d.handleSOCKS5(c)
+	}
+}
+
+func (d *Deps) handleSOCKS5(c net.Conn) {
+	defer c.Close()
+	_ = c.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	br := bufio.NewReaderSize(c, maxTLSRecord)
+	target, user, err := d.socksHandshake(c, br)
+	if err != nil {
+		if d.Logger != nil {
+			d.Logger.Debug().Err(err).Str("client", c.RemoteAddr().String()).Msg("network-debugger: socks handshake failed")
+		}
+		return
+	}
+	_ = c.SetDeadline(time.Time{})
+	remoteAddr := c.RemoteAddr().String()
+	conn := &bufferedConn{Conn: c, r: br}
+	clientID := d.Clients.identify(clientInfo{ip: clientHost(remoteAddr), user: user})
+	ctx := withClientID(withProxyUser(context.Background(), user), clientID)
+
+	if _, port := splitConnectTarget(target); port == 80 {
+		writeSOCKSReply(c, socksRepSucceeded)
+		d.serveSOCKSHTTP(ctx, conn, target)
+		return
+	}
+	if d.MITM.Authority() == nil {
+		// nothing can be intercepted: the reply carries the outcome of the upstream dial
+		skip, ruleID := d.mitmDecision(target, remoteAddr, clientID)
+		t := tunnelTarget{target: target, remoteAddr: remoteAddr, via: "socks", mitmSkipped: skip, mitmRule: ruleID}
+		d.relayTunnel(ctx, c, br, t, func(err error) {
+			writeSOCKSReply(c, socksReplyFor(err))
+		})
+		return
+	}
+	// the decision needs the ClientHello, so the client is told to go ahead first
+	writeSOCKSReply(c, socksRepSucceeded)
+	_ = c.SetReadDeadline(time.Now().Add(socksPeekTimeout))
+	hdr, _ := br.Peek(2)
+	if len(hdr) < 2 || hdr[0] != 0x16 || hdr[1] != 0x03 {
+		_ = c.SetReadDeadline(time.Time{})
+		t := tunnelTarget{target: target, remoteAddr: remoteAddr, via: "socks", mitmSkipped: "not_tls"}
+		d.relayTunnel(ctx, c, br, t, func(error) {})
+		return
+	}
+	hello := peekClientHello(br)
+	_ = c.SetReadDeadline(time.Time{})
+	// clients often connect by IP; the SNI names the host to decide on and to sign for
+	host := target
+	if hello != nil && hello.sni != "" {
+		_, port := splitConnectTarget(target)
+		host = net.JoinHostPort(hello.sni, strconv.Itoa(port))
+	}
+	if skip, ruleID := d.mitmDecision(host, remoteAddr, clientID); skip != "" {
+		t := tunnelTarget{target: host, remoteAddr: remoteAddr, via: "socks", mitmSkipped: skip, mitmRule: ruleID}
+		d.relayTunnel(withPinnedDial(ctx, host, target), c, br, t, func(error) {})
+		return
+	}
+	tun := newMITMTunnel(host, remoteAddr, "mitm")
+	tun.user, tun.clientID = user, clientID
+	if host != target {
+		tun.dialAddr = target
+	}
+	d.interceptTLS(conn, tun)
+}
+
+// socksHandshake negotiates authentication and reads the CONNECT request; it returns the
+// requested host:port and the authenticated user. Username/password auth is required when
+// SOCKS_USERNAME or PROXY_USERS is set. Failures are answered on the wire before returning.
+func (d *Deps) socksHandshake(c net.Conn, br *bufio.Reader) (string, string, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return "", "", err
+	}
+	if hdr[0] != socksVersion {
+		return "", "", errors.New("socks: unsupported version " + strconv.Itoa(int(hdr[0])))
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return "", "", err
+	}
+	want := byte(socksAuthNone)
+	if d.Cfg.SOCKSUsername != "" || len(d.ProxyUsers) > 0 {
+		want = socksAuthUserPass
+	}
+	offered := false
+	for _, m := range methods {
+		offered = offered || m == want
+	}
+	if !offered {
+		_, _ = c.Write([]byte{socksVersion, socksAuthNoAccept})
+		return "", "", errors.New("socks: client offers no acceptable auth method")
+	}
+	if _, err := c.Write([]byte{socksVersion, want}); err != nil {
+		return "", "", err
+	}
+	var user string
+	if want == socksAuthUserPass {
+		u, pass, err := readSOCKSUserPass(br)
+		if err != nil {
+			return "", "", err
+		}
+		if !d.socksCredentialsValid(u, pass) {
+			_, _ = c.Write([]byte{0x01, 0x01})
+			return "", "", errors.New("socks: invalid credentials")
+		}
+		if _, err := c.Write([]byte{0x01, 0x00}); err != nil {
+			return "", "", err
+		}
+		user = u
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(br, req[:]); err != nil {
+		return "", "", err
+	}
+	if req[0] != socksVersion {
+		return "", "", errors.New("socks: bad request version")
+	}
+	var host string
+	switch req[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip := make(net.IP, 4)
+		if req[3] == socksAtypIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return "", "", err
+		}
+		host = ip.String()
+	case socksAtypDomain:
+		n, err := br.ReadByte()
+		if err != nil {
+			return "", "", err
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return "", "", err
+		}
+		host = string(name)
+	default:
+		writeSOCKSReply(c, socksRepAtypUnsupp)
+		return "", "", errors.New("socks: unsupported address type")
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(br, port[:]); err != nil {
+		return "", "", err
+	}
+	if req[1] != socksCmdConnect {
+		writeSOCKSReply(c, socksRepCmdUnsupp)
+		return "", "", errors.New("socks: only CONNECT is supported")
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), user, nil
+}
+
+// socksCredentialsValid accepts SOCKS_USERNAME/SOCKS_PASSWORD and the PROXY_USERS accounts.
+func (d *Deps) socksCredentialsValid(user, pass string) bool {
+	if d.Cfg.SOCKSUsername != "" {
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(d.Cfg.SOCKSUsername)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(d.Cfg.SOCKSPassword)) == 1
+		if userOK && passOK {
+			return true
+		}
+	}
+	return d.ProxyUsers.valid(user, pass)
+}
+
+func readSOCKSUserPass(br *bufio.Reader) (string, string, error) {
+	ver, err := br.ReadByte()
+	if err != nil {
+		return "", "", err
+	}
+	if ver != 0x01 {
+		return "", "", errors.New("socks: bad auth version")
+	}
+	field := func() (string, error) {
+		n, err := br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return string(b), err
+	}
+	user, err := field()
+	if err != nil {
+		return "", "", err
+	}
+	pass, err := field()
+	return user, pass, err
+}
+
+// writeSOCKSReply answers a request; the bound address is not meaningful for CONNECT and is zeroed.
+func writeSOCKSReply(c net.Conn, rep byte) {
+	_, _ = c.Write([]byte{socksVersion, rep, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+}
+
+// socksReplyFor maps a dial error to a SOCKS reply code.
+func socksReplyFor(err error) byte {
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		return socksRepSucceeded
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return socksRepRefused
+	case errors.As(err, &dnsErr), errors.Is(err, syscall.EHOSTUNREACH):
+		return socksRepHostUnreach
+	case errors.Is(err, syscall.ENETUNREACH):
+		return socksRepNetUnreach
+	default:
+		return socksRepFailure
+	}
+}
+
+// serveSOCKSHTTP parses plain HTTP sent through a SOCKS tunnel and captures every request; the
+// exchanges of one SOCKS connection share a tunnelId.
+func (d *Deps) serveSOCKSHTTP(ctx context.Context, conn net.Conn, target string) {
+	tunnelID := id.New()
+	host, _, _ := net.SplitHostPort(target)
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream := url.URL{Scheme: "http", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		d.captureHTTP(w, r, exchange{upstream: &upstream, host: r.Host, via: "socks", tunnelID: tunnelID, clientID: clientIDFrom(ctx)})
+	})
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 60 * time.Second, BaseContext: func(net.Listener) context.Context { return ctx }}
+	_ = srv.Serve(newSingleConnListener(conn))
+}
@@ -0,0 +1,191 @@
+package httpapi
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// proxyWriteWindow is the default write deadline granted to a regular response of known length
+// once upstream headers arrived (PROXY_WRITE_WINDOW_MS), so slow long-polling endpoints are not
+// cut by the server WriteTimeout.
+const proxyWriteWindow = 30 * time.Second
+
+// sseMaxEventBytes caps the data kept for one parsed SSE event (the stream itself is not limited).
+const sseMaxEventBytes = 64 << 10
+
+// isStreamingResponse reports responses consumed incrementally by the client:
+// SSE, NDJSON/JSON streams and multipart replace streams.
+func isStreamingResponse(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch strings.ToLower(mt) {
+	case "text/event-stream", "application/x-ndjson", "application/stream+json", "application/jsonl", "multipart/x-mixed-replace":
+		return true
+	}
+	return false
+}
+
+func isSSEResponse(resp *http.Response) bool {
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return strings.EqualFold(mt, "text/event-stream")
+}
+
+// prepareStreamingResponse adjusts the client write deadline and, for SSE, attaches an
+// incremental parser recording each event of sessionID. Returns whether the response streams
+// (callers must then flush every write).
+func (d *Deps) prepareStreamingResponse(w http.ResponseWriter, resp *http.Response, sessionID string) bool {
+	rc := http.NewResponseController(w)
+	if !isStreamingResponse(resp) {
+		if resp.ContentLength < 0 {
+			// chunked or close-delimited bodies may trickle for as long as upstream keeps them open
+			_ = rc.SetWriteDeadline(time.Time{})
+			return false
+		}
+		window := proxyWriteWindow
+		if d.Cfg.ProxyWriteWindowMs > 0 {
+			window = time.Duration(d.Cfg.ProxyWriteWindowMs) * time.Millisecond
+		}
+		_ = rc.SetWriteDeadline(time.Now().Add(window))
+		return false
+	}
+	// streams may stay open indefinitely
+	_ = rc.SetWriteDeadline(time.Time{})
+	if isSSEResponse(resp) && resp.Body != nil {
+		resp.Body = &sseTap{ReadCloser: resp.Body, p: sseParser{emit: func(ev sseEvent) { d.recordSSEEvent(sessionID, ev) }}}
+	}
+	return true
+}
+
+// recordSSEEvent stores a parsed SSE event as a domain.Event in namespace "sse".
+func (d *Deps) recordSSEEvent(sessionID string, ev sseEvent) {
+	name := ev.event
+	if name == "" {
+		name = "message"
+	}
+	e := domain.Event{ID: id.New(), Ts: time.Now().UTC(), Namespace: "sse", Name: name, ArgsPreview: ev.data, FrameIDs: []string{}, SSEID: ev.id}
+	_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, e)
+	d.Monitor.Broadcast(MonitorEvent{Type: "event_added", ID: sessionID, Ref: e.ID})
+}
+
+// sseTap parses bytes as they flow to the client; it never delays or alters the stream.
+type sseTap struct {
+	io.ReadCloser
+	p sseParser
+}
+
+func (t *sseTap) Read(b []byte) (int, error) {
+	n, err := t.ReadCloser.Read(b)
+	if n > 0 {
+		t.p.feed(b[:n])
+	}
+	if err == io.EOF {
+		t.p.flush()
+	}
+	return n, err
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// sseParser implements the event-stream format: "field: value" lines, events separated by a
+// blank line, ':' comments, CRLF/LF/CR line endings, multi-line data joined with "\n".
+type sseParser struct {
+	emit func(sseEvent)
+
+	line    []byte
+	skipLF  bool
+	lastID  string
+	event   string
+	data    bytes.Buffer
+	hasData bool
+}
+
+func (p *sseParser) feed(b []byte) {
+	for _, c := range b {
+		if p.skipLF {
+			p.skipLF = false
+			if c == '\n' {
+				continue
+			}
+		}
+		switch c {
+		case '\r':
+			p.skipLF = true
+			p.processLine()
+		case '\n':
+			p.processLine()
+		default:
+			if len(p.line) < sseMaxEventBytes {
+				p.line = append(p.line, c)
+			}
+		}
+	}
+}
+
+// flush discards an event not terminated by a blank line when the stream ends, as browsers do.
+func (p *sseParser) flush() {
+	p.line = p.line[:0]
+	p.skipLF = false
+	p.event = ""
+	p.data.Reset()
+	p.hasData = false
+}
+
+func (p *sseParser) processLine() {
+	line := p.line
+	p.line = p.line[:0]
+	if len(line) == 0 {
+		p.dispatch()
+		return
+	}
+	if line[0] == ':' {
+		return
+	}
+	field, value := string(line), ""
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		field = string(line[:i])
+		value = strings.TrimPrefix(string(line[i+1:]), " ")
+	}
+	switch field {
+	case "event":
+		p.event = value
+	case "data":
+		if p.hasData {
+			p.appendData("\n")
+		}
+		p.appendData(value)
+		p.hasData = true
+	case "id":
+		if !strings.ContainsRune(value, 0) {
+			p.lastID = value
+		}
+	}
+}
+
+func (p *sseParser) appendData(s string) {
+	if room := sseMaxEventBytes - p.data.Len(); room < len(s) {
+		s = s[:room]
+	}
+	p.data.WriteString(s)
+}
+
+func (p *sseParser) dispatch() {
+	if p.hasData && p.emit != nil {
+		p.emit(sseEvent{id: p.lastID, event: p.event, data: p.data.String()})
+	}
+	p.event = ""
+	p.data.Reset()
+	p.hasData = false
+}
@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"network-debugger/internal/domain"
+)
+
+// httpTimer collects httptrace milestones of a single outbound request.
+// Hooks may fire concurrently (parallel dials), so timestamps are written atomically:
+// starts keep the first occurrence, "done" milestones keep the last one.
+type httpTimer struct {
+	start          time.Time
+	dnsStartNs     int64
+	dnsDoneNs      int64
+	connStartNs    int64
+	connDoneNs     int64
+	tlsStartNs     int64
+	tlsDoneNs      int64
+	gotConnNs      int64
+	wroteRequestNs int64
+	firstByteNs    int64
+	// bodyDoneNs marks the end of the response body (EOF or close), see trackBody
+	bodyDoneNs int64
+	bodyBytes  int64
+	// bodyErr keeps the first response body read error other than EOF (bodyError)
+	bodyErr atomic.Value
+	// serverAddr holds the remote IP of the connection that carried the request
+	serverAddr atomic.Value
+	// connID / reused describe the pooled connection (see trackedConn)
+	connID atomic.Value
+	reused int32
+	// clientCert holds the mTLS exchange of the connection (*domain.ClientCertUsage)
+	certUsage atomic.Value
+}
+
+func newHTTPTimer() *httpTimer { return &httpTimer{start: time.Now()} }
+
+func markFirst(p *int64) { atomic.CompareAndSwapInt64(p, 0, time.Now().UnixNano()) }
+func markLast(p *int64)  { atomic.StoreInt64(p, time.Now().UnixNano()) }
+
+// clientTrace returns hooks recording the milestones of the request lifecycle.
+func (t *httpTimer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { markFirst(&t.dnsStartNs) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { markLast(&t.dnsDoneNs) },
+		ConnectStart: func(network, addr string) {
+			markFirst(&t.connStartNs)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				markLast(&t.connDoneNs)
+			}
+		},
+		TLSHandshakeStart: func() { markFirst(&t.tlsStartNs) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { markLast(&t.tlsDoneNs) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			markLast(&t.gotConnNs)
+			if ip := remoteIP(info.Conn); ip != "" {
+				t.serverAddr.Store(ip)
+			}
+			if id := connID(info.Conn); id != "" {
+				t.connID.Store(id)
+			}
+			if u := clientCertOf(info.Conn); u != nil {
+				t.certUsage.Store(u)
+			}
+			if info.Reused {
+				atomic.StoreInt32(&t.reused, 1)
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { markLast(&t.wroteRequestNs) },
+		GotFirstResponseByte: func() { markFirst(&t.firstByteNs) },
+	}
+}
+
+func (t *httpTimer) firstByte() time.Time {
+	return timeFromUnixNanoOrZero(atomic.LoadInt64(&t.firstByteNs))
+}
+
+// serverIP returns the IP the request was sent to ("" if no connection was obtained).
+func (t *httpTimer) serverIP() string {
+	ip, _ := t.serverAddr.Load().(string)
+	return ip
+}
+
+// conn returns the pooled connection id and whether it was reused.
+func (t *httpTimer) conn() (string, bool) {
+	id, _ := t.connID.Load().(string)
+	return id, atomic.LoadInt32(&t.reused) == 1
+}
+
+// clientCert returns the client certificate exchange of the connection used (nil if unknown).
+func (t *httpTimer) clientCert() *domain.ClientCertUsage {
+	u, _ := t.certUsage.Load().(*domain.ClientCertUsage)
+	return u
+}
+
+// trackBody wraps a response body so the timer learns when (and after how many bytes) it finished.
+func (t *httpTimer) trackBody(rc io.ReadCloser) io.ReadCloser {
+	if rc == nil {
+		return rc
+	}
+	return &timedBody{ReadCloser: rc, t: t}
+}
+
+// bodyError returns the first error the response body failed with (nil after a clean EOF).
+func (t *httpTimer) bodyError() error {
+	e, _ := t.bodyErr.Load().(bodyError)
+	return e.err
+}
+
+// bodyError boxes errors for atomic.Value, which needs one concrete type.
+type bodyError struct{ err error }
+
+// bodyDone returns the body completion time (zero while still streaming) and the bytes read.
+func (t *httpTimer) bodyDone() (time.Time, int64) {
+	return timeFromUnixNanoOrZero(atomic.LoadInt64(&t.bodyDoneNs)), atomic.LoadInt64(&t.bodyBytes)
+}
+
+type timedBody struct {
+	io.ReadCloser
+	t *httpTimer
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.t.bodyBytes, int64(n))
+	if err != nil {
+		markFirst(&b.t.bodyDoneNs)
+		if err != io.EOF {
+			b.t.bodyErr.CompareAndSwap(nil, bodyError{err})
+		}
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	markFirst(&b.t.bodyDoneNs)
+	return b.ReadCloser.Close()
+}
+
+// timings converts collected milestones into HTTPTimings; end marks completion of the exchange
+// (the end of the response body once known, otherwise the moment of the call).
+// Phases: blocked (queueing/pool wait) → dns → connect (TCP) → tls → send → wait → receive.
+func (t *httpTimer) timings(end time.Time) domain.HTTPTimings {
+	at := func(p *int64) time.Time { return timeFromUnixNanoOrZero(atomic.LoadInt64(p)) }
+	gotConn := at(&t.gotConnNs)
+	wrote := at(&t.wroteRequestNs)
+	firstByte := t.firstByte()
+	out := domain.HTTPTimings{
+		DNS:     durationMs(at(&t.dnsStartNs), at(&t.dnsDoneNs)),
+		Connect: durationMs(at(&t.connStartNs), at(&t.connDoneNs)),
+		TLS:     durationMs(at(&t.tlsStartNs), at(&t.tlsDoneNs)),
+		Send:    durationMs(gotConn, wrote),
+		Wait:    durationMs(wrote, firstByte),
+		Receive: durationMs(firstByte, end),
+		TTFB:    durationMs(t.start, firstByte),
+		Total:   durationMs(t.start, end),
+	}
+	if blocked := durationMs(t.start, gotConn) - out.DNS - out.Connect - out.TLS; blocked > 0 {
+		out.Blocked = blocked
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// TLSPolicy tunes upstream TLS for matching hosts (UPSTREAM_TLS_POLICIES).
+type TLSPolicy struct {
+	Patterns []string
+	// Insecure skips certificate verification for these hosts only
+	Insecure   bool
+	MinVersion uint16
+	MaxVersion uint16
+	// CipherSuites restricts TLS 1.0–1.2 suites (TLS 1.3 suites are not configurable)
+	CipherSuites []uint16
+}
+
+// UpstreamTLS holds the trust store and per-host verification policy of outbound TLS.
+type UpstreamTLS struct {
+	// Roots are the system roots plus UPSTREAM_CA_BUNDLE (nil = system roots only)
+	Roots *x509.CertPool
+	// InsecureAll mirrors INSECURE_TLS: no verification for any host
+	InsecureAll bool
+	Policies    []TLSPolicy
+}
+
+// LoadCABundle returns the system pool extended with the PEM certificates of files (comma separated).
+func LoadCABundle(files string) (*x509.CertPool, error) {
+	if strings.TrimSpace(files) == "" {
+		return nil, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	var errs []string
+	for _, f := range strings.Split(files, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			errs = append(errs, f+": no PEM certificates found")
+		}
+	}
+	if len(errs) > 0 {
+		return pool, errors.New("ca bundle: " + strings.Join(errs, "; "))
+	}
+	return pool, nil
+}
+
+// ParseTLSPolicies parses "patterns=opts;…" with space separated options:
+// insecure, minVersion:1.2, maxVersion:1.3, ciphers:NAME|NAME (Go/IANA suite names), e.g.
+// "*.dev.local=insecure; api.bank.com=minVersion:1.3; legacy.local=maxVersion:1.2 ciphers:TLS_RSA_WITH_AES_128_CBC_SHA".
+func ParseTLSPolicies(s string) ([]TLSPolicy, error) {
+	var out []TLSPolicy
+	var errs []string
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		lhs, rhs, ok := strings.Cut(rule, "=")
+		if !ok {
+			errs = append(errs, "tls policy without '=': "+rule)
+			continue
+		}
+		p := TLSPolicy{Patterns: splitCSVLower(lhs)}
+		valid := len(p.Patterns) > 0
+		for _, opt := range strings.Fields(rhs) {
+			k, v, _ := strings.Cut(opt, ":")
+			var err error
+			switch strings.ToLower(k) {
+			case "insecure":
+				p.Insecure = true
+			case "minversion":
+				p.MinVersion, err = parseTLSVersion(v)
+			case "maxversion":
+				p.MaxVersion, err = parseTLSVersion(v)
+			case "ciphers":
+				p.CipherSuites, err = parseCipherSuites(v)
+			default:
+				err = errors.New("unknown tls policy option: " + opt)
+			}
+			if err != nil {
+				errs = append(errs, err.Error())
+				valid = false
+			}
+		}
+		if valid {
+			out = append(out, p)
+		}
+	}
+	if len(errs) > 0 {
+		return out, errors.New("tls policies: " + strings.Join(errs, "; "))
+	}
+	return out, nil
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(v), "tls") {
+	case "1.0", "1":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, errors.New("unsupported tls version: " + v)
+}
+
+func parseCipherSuites(v string) ([]uint16, error) {
+	known := map[string]uint16{}
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[cs.Name] = cs.ID
+	}
+	var out []uint16
+	for _, name := range strings.Split(v, "|") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, errors.New("unknown cipher suite: " + name)
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+func (u *UpstreamTLS) policyFor(host string) *TLSPolicy {
+	host = strings.ToLower(host)
+	for i := range u.Policies {
+		for _, pat := range u.Policies[i].Patterns {
+			if matchUpstreamPattern(pat, host) {
+				return &u.Policies[i]
+			}
+		}
+	}
+	return nil
+}
+
+// ClientConfig builds the client tls.Config for serverName. Verification is done in
+// VerifyConnection against Roots so a failure can carry the presented chain (tlsVerifyError).
+func (u *UpstreamTLS) ClientConfig(serverName string) *tls.Config {
+	cfg := &tls.Config{ServerName: serverName}
+	insecure := false
+	if u != nil {
+		insecure = u.InsecureAll
+		if p := u.policyFor(serverName); p != nil {
+			insecure = insecure || p.Insecure
+			cfg.MinVersion, cfg.MaxVersion, cfg.CipherSuites = p.MinVersion, p.MaxVersion, p.CipherSuites
+		}
+	}
+	cfg.InsecureSkipVerify = true
+	if insecure {
+		return cfg
+	}
+	var roots *x509.CertPool
+	if u != nil {
+		roots = u.Roots
+	}
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return &tlsVerifyError{Host: serverName, Err: errors.New("tls: server presented no certificate")}
+		}
+		opts := x509.VerifyOptions{Roots: roots, DNSName: serverName, Intermediates: x509.NewCertPool()}
+		for _, c := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+		if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+			return &tlsVerifyError{Host: serverName, Err: err, Chain: cs.PeerCertificates}
+		}
+		return nil
+	}
+	return cfg
+}
+
+// tlsVerifyError is an upstream certificate verification failure with the presented chain.
+type tlsVerifyError struct {
+	Host  string
+	Err   error
+	Chain []*x509.Certificate
+}
+
+func (e *tlsVerifyError) Error() string {
+	return "tls: failed to verify certificate for " + e.Host + ": " + e.Err.Error()
+}
+
+func (e *tlsVerifyError) Unwrap() error { return e.Err }
+
+// recordTLSFailure adds a frame describing an upstream certificate verification failure
+// (error, host and the full presented chain incl. PEM) to the session; other errors are ignored.
+func (d *Deps) recordTLSFailure(sessionID string, err error) {
+	var ve *tlsVerifyError
+	if !errors.As(err, &ve) {
+		return
+	}
+	chain := certsSummary(ve.Chain)
+	for i, c := range ve.Chain {
+		chain[i]["pem"] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}
+	preview := map[string]any{"type": "tls_error", "host": ve.Host, "error": ve.Err.Error(), "chain": chain}
+	b, _ := json.Marshal(preview)
+	fr := domain.Frame{ID: id.New(), Ts: time.Now().UTC(), Direction: domain.DirectionUpstreamToClient, Opcode: domain.OpcodeText, Size: len(b), Preview: string(b)}
+	_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
+	d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
+}
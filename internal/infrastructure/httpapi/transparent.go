@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// transparentHelloTimeout bounds how long a client may take to send its ClientHello.
+const transparentHelloTimeout = 10 * time.Second
+
+// ServeTransparentTLS accepts raw TLS connections on ln (TRANSPARENT_TLS_ADDR), e.g. from apps
+// that ignore proxy settings and reach the debugger through a DNS override. The upstream is the
+// SNI at TRANSPARENT_UPSTREAM_PORT, resolved through TRANSPARENT_DNS_SERVER (default: the
+// outbound resolver). Interceptable hosts are decrypted like CONNECT MITM (h1, h2, WebSocket,
+// via "transparent"); the rest become opaque tunnel sessions.
+func (d *Deps) ServeTransparentTLS(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go d.handleTransparentTLS(c)
+	}
+}
+
+func (d *Deps) handleTransparentTLS(c net.Conn) {
+	defer c.Close()
+	remoteAddr := c.RemoteAddr().String()
+	br := bufio.NewReaderSize(c, maxTLSRecord)
+	_ = c.SetReadDeadline(time.Now().Add(transparentHelloTimeout))
+	hello := peekClientHello(br)
+	_ = c.SetReadDeadline(time.Time{})
+	if hello == nil || hello.sni == "" {
+		d.logTransparentError(remoteAddr, errors.New("transparent: connection without TLS SNI"))
+		return
+	}
+	target := net.JoinHostPort(hello.sni, strconv.Itoa(d.transparentUpstreamPort()))
+	dialAddr, err := d.resolveTransparent(c, hello.sni)
+	if err != nil {
+		d.logTransparentError(remoteAddr, err)
+		return
+	}
+
+	clientID := d.Clients.identify(clientInfo{ip: clientHost(remoteAddr)})
+	if skip, ruleID := d.mitmDecision(target, remoteAddr, clientID); skip != "" {
+		t := tunnelTarget{target: target, remoteAddr: remoteAddr, via: "transparent", mitmSkipped: skip, mitmRule: ruleID}
+		ctx := withClientID(withPinnedDial(context.Background(), target, dialAddr), clientID)
+		d.relayTunnel(ctx, c, br, t, func(error) {})
+		return
+	}
+	tun := newMITMTunnel(target, remoteAddr, "transparent")
+	tun.dialAddr, tun.clientID = dialAddr, clientID
+	d.interceptTLS(&bufferedConn{Conn: c, r: br}, tun)
+}
+
+// resolveTransparent returns the ip:port to dial for sni. It refuses the listener's own
+// address: the resolver still sees the DNS override and the connection would loop.
+func (d *Deps) resolveTransparent(c net.Conn, sni string) (string, error) {
+	r := d.TransparentDNS
+	if r == nil {
+		r = d.DNS
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ip, err := r.LookupIP(ctx, sni)
+	if err != nil {
+		return "", err
+	}
+	dialAddr := net.JoinHostPort(ip, strconv.Itoa(d.transparentUpstreamPort()))
+	if local, ok := c.LocalAddr().(*net.TCPAddr); ok && local.String() == dialAddr {
+		return "", errors.New("transparent: " + sni + " resolves to this listener; set TRANSPARENT_DNS_SERVER to a resolver without the override")
+	}
+	return dialAddr, nil
+}
+
+func (d *Deps) transparentUpstreamPort() int {
+	if d.Cfg.TransparentUpstreamPort > 0 {
+		return d.Cfg.TransparentUpstreamPort
+	}
+	return 443
+}
+
+func (d *Deps) logTransparentError(remoteAddr string, err error) {
+	if d.Logger != nil {
+		d.Logger.Warn().Err(err).Str("client", remoteAddr).Msg("network-debugger: transparent TLS connection dropped")
+	}
+}
@@ -0,0 +1,238 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"network-debugger/internal/domain"
+)
+
+// transportSettings identifies one pooled transport; hosts with equal settings share it.
+type transportSettings struct {
+	// proto: "" (negotiate), "1.1" or "2"
+	proto               string
+	maxConnsPerHost     int
+	maxIdleConnsPerHost int
+}
+
+// HostPolicy tunes the upstream transport for matching hosts (UPSTREAM_HOST_POLICIES).
+type HostPolicy struct {
+	Patterns []string
+	// Proto forces the protocol: "1.1" or "2"; empty keeps the default.
+	Proto string
+	// MaxConns limits connections per host (0 keeps the default).
+	MaxConns int
+}
+
+// TransportPool is the shared upstream http.RoundTripper: connections are kept alive and reused
+// across requests of all proxy flows. One http.Transport exists per distinct settings set
+// (defaults or a matching HostPolicy), created lazily.
+type TransportPool struct {
+	build    func(transportSettings) http.RoundTripper
+	defaults transportSettings
+	policies []HostPolicy
+
+	mu         sync.Mutex
+	transports map[transportSettings]http.RoundTripper
+}
+
+// NewTransportPool creates the shared pool; build constructs the transport for a settings set.
+func NewTransportPool(build func(transportSettings) http.RoundTripper, defaults transportSettings, policies []HostPolicy) *TransportPool {
+	return &TransportPool{build: build, defaults: defaults, policies: policies, transports: map[transportSettings]http.RoundTripper{}}
+}
+
+// ParseHostPolicies parses "patterns=opts;…" where opts are space separated key:value pairs,
+// e.g. "legacy.corp.local=proto:1.1 maxConns:4; *.grpc.local=proto:2".
+func ParseHostPolicies(s string) ([]HostPolicy, error) {
+	var out []HostPolicy
+	var errs []string
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		lhs, rhs, ok := strings.Cut(rule, "=")
+		if !ok {
+			errs = append(errs, "policy without '=': "+rule)
+			continue
+		}
+		p := HostPolicy{Patterns: splitCSVLower(lhs)}
+		valid := len(p.Patterns) > 0
+		for _, opt := range strings.Fields(rhs) {
+			k, v, _ := strings.Cut(opt, ":")
+			switch strings.ToLower(k) {
+			case "proto":
+				proto, err := normalizeHTTPVersion(v)
+				if err != nil {
+					errs = append(errs, err.Error())
+					valid = false
+				}
+				p.Proto = proto
+			case "maxconns":
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					errs = append(errs, "invalid maxConns: "+v)
+					valid = false
+				}
+				p.MaxConns = n
+			default:
+				errs = append(errs, "unknown policy option: "+opt)
+				valid = false
+			}
+		}
+		if valid {
+			out = append(out, p)
+		}
+	}
+	if len(errs) > 0 {
+		return out, errors.New("host policies: " + strings.Join(errs, "; "))
+	}
+	return out, nil
+}
+
+// normalizeHTTPVersion maps user spellings to "", "1.1" or "2".
+func normalizeHTTPVersion(v string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "auto":
+		return "", nil
+	case "1.1", "1", "http/1.1", "h1":
+		return "1.1", nil
+	case "2", "h2", "http/2":
+		return "2", nil
+	default:
+		return "", errors.New("unsupported http version: " + v)
+	}
+}
+
+// settingsFor resolves the transport settings for host; proto (if not empty) overrides policies.
+func (p *TransportPool) settingsFor(host, proto string) transportSettings {
+	s := p.defaults
+	h := strings.ToLower(host)
+	if v, _, err := net.SplitHostPort(host); err == nil {
+		h = strings.ToLower(v)
+	}
+	for _, pol := range p.policies {
+		matched := false
+		for _, pat := range pol.Patterns {
+			if matchUpstreamPattern(pat, h) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if pol.Proto != "" {
+			s.proto = pol.Proto
+		}
+		if pol.MaxConns > 0 {
+			s.maxConnsPerHost = pol.MaxConns
+		}
+		break
+	}
+	if proto != "" {
+		s.proto = proto
+	}
+	return s
+}
+
+func (p *TransportPool) get(s transportSettings) http.RoundTripper {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rt, ok := p.transports[s]
+	if !ok {
+		rt = p.build(s)
+		p.transports[s] = rt
+	}
+	return rt
+}
+
+// RoundTrip sends req over the pooled transport selected for its host.
+func (p *TransportPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	return p.get(p.settingsFor(req.URL.Host, "")).RoundTrip(req)
+}
+
+// WithHTTPVersion returns a RoundTripper forcing the protocol ("", "1.1", "2") while still
+// sharing pooled connections with other requests of the same settings.
+func (p *TransportPool) WithHTTPVersion(v string) (http.RoundTripper, error) {
+	proto, err := normalizeHTTPVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	if proto == "" {
+		return p, nil
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return p.get(p.settingsFor(req.URL.Host, proto)).RoundTrip(req)
+	}), nil
+}
+
+// CloseIdleConnections drops idle connections of all pooled transports
+// (e.g. after DNS overrides changed).
+func (p *TransportPool) CloseIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rt := range p.transports {
+		closeIdleConnections(rt)
+	}
+}
+
+var connSeq uint64
+
+// trackedConn tags an upstream connection with a process-unique id so transactions can show
+// which requests shared a connection.
+type trackedConn struct {
+	net.Conn
+	id string
+	// clientCert records the mTLS exchange of a TLS session on top of this connection
+	mu         sync.Mutex
+	clientCert domain.ClientCertUsage
+}
+
+func newTrackedConn(c net.Conn) net.Conn {
+	return &trackedConn{Conn: c, id: "c" + strconv.FormatUint(atomic.AddUint64(&connSeq, 1), 10)}
+}
+
+// trackedOf unwraps TLS layers down to the tracked connection, or returns nil.
+func trackedOf(c net.Conn) *trackedConn {
+	for c != nil {
+		switch v := c.(type) {
+		case *trackedConn:
+			return v
+		case *tls.Conn:
+			c = v.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// connID returns the id of a tracked connection (unwrapping TLS), or "".
+func connID(c net.Conn) string {
+	if tc := trackedOf(c); tc != nil {
+		return tc.id
+	}
+	return ""
+}
+
+// protocolName maps resp.Proto to a short protocol label (HAR-like): "http/1.1", "h2", …
+func protocolName(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	switch {
+	case resp.ProtoMajor == 2:
+		return "h2"
+	case resp.ProtoMajor == 3:
+		return "h3"
+	default:
+		return strings.ToLower(resp.Proto)
+	}
+}
@@ -0,0 +1,145 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// maxTLSRecord is the largest TLS plaintext record plus its header; a ClientHello fits in one.
+const maxTLSRecord = 5 + 16384
+
+// tunnelTarget describes a tunnel relayed without decryption.
+type tunnelTarget struct {
+	target     string // upstream host:port
+	remoteAddr string // client address
+	via        string // "forward" (CONNECT) | "socks" | "transparent"
+	// mitmSkipped / mitmRule: why the tunnel is not intercepted (see domain.TunnelInfo)
+	mitmSkipped string
+	mitmRule    string
+}
+
+// relayTunnel dials t.target and copies bytes both ways until either side closes. The session
+// (kind "tunnel") records the SNI/ALPN of a TLS ClientHello, bytes per direction, dial time,
+// lifetime and why the tunnel was not intercepted. established reports the dial result to the
+// client (CONNECT status line, SOCKS reply) before any byte is relayed.
+func (d *Deps) relayTunnel(ctx context.Context, clientConn net.Conn, clientR io.Reader, t tunnelTarget, established func(error)) {
+	started := time.Now()
+	sessionID := id.New()
+	_ = d.Svc.Create(contextWithNoCancel(), domain.Session{ID: sessionID, Target: "connect://" + t.target, ClientAddr: clientHost(t.remoteAddr), StartedAt: started.UTC(), Kind: "tunnel", Via: t.via, User: proxyUser(ctx), ClientID: clientIDFrom(ctx), Tunnel: &domain.TunnelInfo{MITMSkipped: t.mitmSkipped, MITMRule: t.mitmRule}})
+	d.Monitor.Broadcast(MonitorEvent{Type: "session_started", ID: sessionID})
+	d.Metrics.ActiveSessions.Inc()
+	var (
+		closeErr error
+		up, down int64
+		dialMs   int64
+	)
+	defer func() {
+		_ = d.Svc.UpdateSession(contextWithNoCancel(), sessionID, func(s *domain.Session) {
+			if s.Tunnel != nil {
+				// copy on write: readers may hold the previous value
+				ti := *s.Tunnel
+				ti.BytesUp, ti.BytesDown = up, down
+				ti.DialMs = dialMs
+				ti.DurationMs = time.Since(started).Milliseconds()
+				s.Tunnel = &ti
+			}
+		})
+		var errPtr *string
+		if closeErr != nil {
+			errPtr = strPtr(closeErr.Error())
+		}
+		_ = d.Svc.SetClosed(contextWithNoCancel(), sessionID, time.Now().UTC(), errPtr)
+		d.Monitor.Broadcast(MonitorEvent{Type: "session_ended", ID: sessionID})
+		d.Metrics.ActiveSessions.Dec()
+	}()
+
+	// Dial upstream (directly or through the configured upstream proxy)
+	upstreamConn, err := d.Upstream.DialContext(ctx, "tcp", t.target)
+	dialMs = time.Since(started).Milliseconds()
+	established(err)
+	if err != nil {
+		closeErr = err
+		return
+	}
+	defer upstreamConn.Close()
+	d.recordServerIP(sessionID, remoteIP(upstreamConn))
+
+	// bidirectional copy; the client side is peeked for a ClientHello before relaying
+	done := make(chan int64, 1)
+	go func() {
+		br := bufio.NewReaderSize(clientR, maxTLSRecord)
+		// look only at what the first read brought: a protocol whose first message is shorter
+		// than a record header and then waits for a reply must not stall the relay
+		if _, err := br.Peek(1); err == nil && br.Buffered() >= 5 {
+			if hello := peekClientHello(br); hello != nil {
+				_ = d.Svc.UpdateSession(contextWithNoCancel(), sessionID, func(s *domain.Session) {
+					if s.Tunnel != nil {
+						ti := *s.Tunnel
+						ti.TLS, ti.SNI, ti.ALPN = true, hello.sni, hello.alpn
+						s.Tunnel = &ti
+					}
+				})
+			}
+		}
+		n, _ := io.Copy(upstreamConn, br)
+		_ = upstreamConn.Close()
+		done <- n
+	}()
+	down, _ = io.Copy(clientConn, upstreamConn)
+	_ = clientConn.Close()
+	up = <-done
+}
+
+// clientHello is the part of a TLS ClientHello recorded for opaque tunnels.
+type clientHello struct {
+	sni  string
+	alpn []string
+}
+
+var errHelloSeen = errors.New("client hello captured")
+
+// peekClientHello looks at the first record the client sent without consuming it. It returns
+// nil when the connection does not start with a TLS handshake or the hello does not parse.
+func peekClientHello(br *bufio.Reader) *clientHello {
+	hdr, err := br.Peek(5)
+	if err != nil || hdr[0] != 0x16 || hdr[1] != 0x03 {
+		return nil
+	}
+	n := 5 + (int(hdr[3])<<8 | int(hdr[4]))
+	if n > maxTLSRecord {
+		n = maxTLSRecord
+	}
+	// a short peek (client closed early) still parses when the hello is complete
+	rec, _ := br.Peek(n)
+	// let crypto/tls parse the hello and stop right after it
+	var out *clientHello
+	srv := tls.Server(&helloConn{r: bytes.NewReader(rec)}, &tls.Config{
+		GetConfigForClient: func(h *tls.ClientHelloInfo) (*tls.Config, error) {
+			out = &clientHello{sni: h.ServerName, alpn: append([]string(nil), h.SupportedProtos...)}
+			return nil, errHelloSeen
+		},
+	})
+	_ = srv.Handshake()
+	return out
+}
+
+// helloConn feeds recorded bytes to tls.Server and discards whatever it writes back.
+type helloConn struct{ r io.Reader }
+
+func (c *helloConn) Read(p []byte) (int, error)       { return c.r.Read(p) }
+func (c *helloConn) Write(p []byte) (int, error)      { return len(p), nil }
+func (c *helloConn) Close() error                     { return nil }
+func (c *helloConn) LocalAddr() net.Addr              { return &net.TCPAddr{} }
+func (c *helloConn) RemoteAddr() net.Addr             { return &net.TCPAddr{} }
+func (c *helloConn) SetDeadline(time.Time) error      { return nil }
+func (c *helloConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *helloConn) SetWriteDeadline(time.Time) error { return nil }
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+
+	"network-debugger/internal/domain"
+)
+
+// upstreamTLSConfig returns the client TLS settings used for serverName by every outbound flow
+// (HTTP transport, WS dialer, MITM upstream): trust store and per-host policy of d.UpstreamTLS.
+func (d *Deps) upstreamTLSConfig(serverName string) *tls.Config {
+	return d.UpstreamTLS.ClientConfig(serverName)
+}
+
+// upstreamTLSConn wraps a dialed connection into a TLS client for serverName that presents the
+// matching client certificate (ClientCerts) and records the exchange on the tracked connection.
+// The handshake is left to the caller.
+func (d *Deps) upstreamTLSConn(raw net.Conn, serverName string, alpn []string) *tls.Conn {
+	tc := trackedOf(raw)
+	if tc == nil {
+		tc = newTrackedConn(raw).(*trackedConn)
+	}
+	cfg := d.upstreamTLSConfig(serverName)
+	cfg.NextProtos = alpn
+	cfg.GetClientCertificate = d.ClientCerts.clientCertHook(serverName, &tc.clientCert, &tc.mu)
+	return tls.Client(tc, cfg)
+}
+
+// dialUpstreamTLS dials addr through the upstream router (proxies, DNS overrides) and returns an
+// unhandshaken TLS client connection.
+func (d *Deps) dialUpstreamTLS(ctx context.Context, network, addr string, alpn []string) (*tls.Conn, error) {
+	raw, err := d.Upstream.DialerFor("https")(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	return d.upstreamTLSConn(newTrackedConn(raw), host, alpn), nil
+}
+
+// handshakeWithTrace completes the TLS handshake, reporting it to httptrace hooks in ctx.
+func handshakeWithTrace(ctx context.Context, c *tls.Conn) error {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	err := c.HandshakeContext(ctx)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(c.ConnectionState(), err)
+	}
+	if err != nil {
+		_ = c.Close()
+	}
+	return err
+}
+
+// clientCertOf returns the mTLS exchange recorded for a connection (nil when unknown).
+func clientCertOf(c net.Conn) *domain.ClientCertUsage {
+	tc := trackedOf(c)
+	if tc == nil {
+		return nil
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	u := tc.clientCert
+	return &u
+}
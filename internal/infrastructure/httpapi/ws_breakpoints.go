@@ -0,0 +1,358 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sio "network-debugger/internal/adapters/decoders/socketio"
+	"network-debugger/internal/domain"
+	"network-debugger/pkg/shared/id"
+)
+
+// WSBreakpoint holds /wsproxy messages that match all of its criteria until they are released,
+// edited or dropped via /_api/v1/ws/paused. Empty criteria match everything.
+type WSBreakpoint struct {
+	ID        string `json:"id"`
+	SessionID string `json:"sessionId,omitempty"`
+	Direction string `json:"direction,omitempty"` // "client->upstream" | "upstream->client"
+	Opcode    string `json:"opcode,omitempty"`    // "text" | "binary"
+	// Event and Namespace match Socket.IO event frames ("42…").
+	Event     string `json:"event,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// JSONPath selects a value of the JSON payload (Socket.IO frames: the args array), e.g.
+	// "$.user.id" or "$[1].type"; the frame matches when it exists. Regex is matched against
+	// that value when JSONPath is set, else against the whole payload.
+	JSONPath string `json:"jsonPath,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+
+	re   *regexp.Regexp
+	path []jsonPathStep
+}
+
+// compile validates the breakpoint and prepares its matchers.
+func (b *WSBreakpoint) compile() error {
+	switch domain.Direction(b.Direction) {
+	case "", domain.DirectionClientToUpstream, domain.DirectionUpstreamToClient:
+	default:
+		return errors.New("direction must be client->upstream or upstream->client")
+	}
+	switch domain.Opcode(b.Opcode) {
+	case "", domain.OpcodeText, domain.OpcodeBinary:
+	default:
+		return errors.New("opcode must be text or binary")
+	}
+	b.re = nil
+	if b.Regex != "" {
+		re, err := regexp.Compile(b.Regex)
+		if err != nil {
+			return errors.New("invalid regex: " + err.Error())
+		}
+		b.re = re
+	}
+	b.path = nil
+	if b.JSONPath != "" {
+		p, err := parseJSONPath(b.JSONPath)
+		if err != nil {
+			return err
+		}
+		b.path = p
+	}
+	return nil
+}
+
+func (b *WSBreakpoint) ruleID() string     { return b.ID }
+func (b *WSBreakpoint) setRuleID(v string) { b.ID = v }
+
+func (b *WSBreakpoint) matches(sessionID string, dir domain.Direction, op domain.Opcode, data []byte) bool {
+	if (b.SessionID != "" && b.SessionID != sessionID) || (b.Direction != "" && domain.Direction(b.Direction) != dir) || (b.Opcode != "" && domain.Opcode(b.Opcode) != op) {
+		return false
+	}
+	raw := strings.TrimSpace(string(data))
+	nsp, ev, args, isEvent := "", "", "", false
+	if op == domain.OpcodeText {
+		nsp, ev, args, isEvent = sio.ParseEvent(raw)
+	}
+	if b.Event != "" && (!isEvent || ev != b.Event) {
+		return false
+	}
+	if b.Namespace != "" && (!isEvent || strings.TrimPrefix(nsp, "/") != strings.TrimPrefix(b.Namespace, "/")) {
+		return false
+	}
+	subject := string(data)
+	if b.path != nil {
+		doc := raw
+		if isEvent {
+			doc = args
+		}
+		var v any
+		if json.Unmarshal([]byte(doc), &v) != nil {
+			return false
+		}
+		v, ok := evalJSONPath(v, b.path)
+		if !ok {
+			return false
+		}
+		if s, isStr := v.(string); isStr {
+			subject = s
+		} else {
+			enc, _ := json.Marshal(v)
+			subject = string(enc)
+		}
+	}
+	return b.re == nil || b.re.MatchString(subject)
+}
+
+// jsonPathStep is one ".key" or "[index]" of a JSONPath.
+type jsonPathStep struct {
+	key   string
+	index int // -1 for key steps
+}
+
+// parseJSONPath accepts the dotted subset of JSONPath: $.a.b, $.a[0].b, $['a b'].
+func parseJSONPath(p string) ([]jsonPathStep, error) {
+	bad := errors.New("invalid jsonPath " + strconv.Quote(p) + " (want e.g. $.a.b[0])")
+	s := strings.TrimPrefix(strings.TrimSpace(p), "$")
+	steps := []jsonPathStep{}
+	for s != "" {
+		switch {
+		case s[0] == '.':
+			s = s[1:]
+			n := strings.IndexAny(s, ".[")
+			if n < 0 {
+				n = len(s)
+			}
+			if n == 0 {
+				return nil, bad
+			}
+			steps = append(steps, jsonPathStep{key: s[:n], index: -1})
+			s = s[n:]
+		case strings.HasPrefix(s, "['"):
+			end := strings.Index(s, "']")
+			if end < 0 {
+				return nil, bad
+			}
+			steps = append(steps, jsonPathStep{key: s[2:end], index: -1})
+			s = s[end+2:]
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, bad
+			}
+			i, err := strconv.Atoi(s[1:end])
+			if err != nil || i < 0 {
+				return nil, bad
+			}
+			steps = append(steps, jsonPathStep{index: i})
+			s = s[end+1:]
+		default:
+			return nil, bad
+		}
+	}
+	return steps, nil
+}
+
+func evalJSONPath(v any, steps []jsonPathStep) (any, bool) {
+	for _, st := range steps {
+		if st.index < 0 {
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[st.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		a, ok := v.([]any)
+		if !ok || st.index >= len(a) {
+			return nil, false
+		}
+		v = a[st.index]
+	}
+	return v, true
+}
+
+// PausedWSFrame is a message held by a breakpoint. Payload is text for text frames and base64
+// (Encoding "base64") for binary ones.
+type PausedWSFrame struct {
+	ID           string           `json:"id"`
+	SessionID    string           `json:"sessionId"`
+	BreakpointID string           `json:"breakpointId"`
+	Direction    domain.Direction `json:"direction"`
+	Opcode       domain.Opcode    `json:"opcode"`
+	Size         int              `json:"size"`
+	Payload      string           `json:"payload"`
+	Encoding     string           `json:"encoding"` // "text" | "base64"
+	PausedAt     time.Time        `json:"pausedAt"`
+}
+
+// wsFrameDecision resolves a paused frame; data nil forwards it unchanged.
+type wsFrameDecision struct {
+	drop bool
+	data []byte
+}
+
+type pausedWSFrame struct {
+	PausedWSFrame
+	decided chan wsFrameDecision
+}
+
+// WSBreakpoints holds the WebSocket breakpoints (/_api/v1/ws/breakpoints) and the frames they
+// are currently holding (/_api/v1/ws/paused).
+type WSBreakpoints struct {
+	rules  ruleList[WSBreakpoint, *WSBreakpoint]
+	mu     sync.RWMutex
+	paused map[string]*pausedWSFrame
+}
+
+func NewWSBreakpoints() *WSBreakpoints {
+	return &WSBreakpoints{paused: make(map[string]*pausedWSFrame)}
+}
+
+// match returns the id of the first breakpoint matching the message ("" when none does).
+func (b *WSBreakpoints) match(sessionID string, dir domain.Direction, op domain.Opcode, data []byte) string {
+	if b == nil {
+		return ""
+	}
+	r := b.rules.first(func(r *WSBreakpoint) bool { return r.matches(sessionID, dir, op, data) })
+	if r == nil {
+		return ""
+	}
+	return r.ID
+}
+
+func (b *WSBreakpoints) hold(f PausedWSFrame) *pausedWSFrame {
+	p := &pausedWSFrame{PausedWSFrame: f, decided: make(chan wsFrameDecision, 1)}
+	b.mu.Lock()
+	b.paused[f.ID] = p
+	b.mu.Unlock()
+	return p
+}
+
+func (b *WSBreakpoints) unhold(frameID string) {
+	b.mu.Lock()
+	delete(b.paused, frameID)
+	b.mu.Unlock()
+}
+
+// decide hands dec to the pipe holding frameID; false when no such frame is paused.
+func (b *WSBreakpoints) decide(frameID string, dec wsFrameDecision) bool {
+	b.mu.Lock()
+	p, ok := b.paused[frameID]
+	delete(b.paused, frameID)
+	b.mu.Unlock()
+	if ok {
+		p.decided <- dec
+	}
+	return ok
+}
+
+// Paused lists the held frames (of one session when sessionID is set), oldest first.
+func (b *WSBreakpoints) Paused(sessionID string) []PausedWSFrame {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make([]PausedWSFrame, 0, len(b.paused))
+	for _, p := range b.paused {
+		if sessionID == "" || p.SessionID == sessionID {
+			out = append(out, p.PausedWSFrame)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PausedAt.Before(out[j].PausedAt) })
+	return out
+}
+
+// Rules returns a copy of the breakpoints in evaluation order.
+func (b *WSBreakpoints) Rules() []WSBreakpoint {
+	return b.rules.all()
+}
+
+// pauseWSFrame holds a message that hit breakpoint ruleID until it is decided via the API or
+// the session ends (ok false). The calling pipe stops reading meanwhile, so later messages of
+// the same direction queue behind the paused one.
+func (d *Deps) pauseWSFrame(sessionID, ruleID string, dir domain.Direction, op domain.Opcode, data []byte) (dec wsFrameDecision, ok bool) {
+	f := PausedWSFrame{ID: id.New(), SessionID: sessionID, BreakpointID: ruleID, Direction: dir, Opcode: op, Size: len(data), Payload: string(data), Encoding: "text", PausedAt: time.Now().UTC()}
+	if op != domain.OpcodeText {
+		f.Payload, f.Encoding = base64.StdEncoding.EncodeToString(data), "base64"
+	}
+	p := d.WSBreakpoints.hold(f)
+	defer d.WSBreakpoints.unhold(f.ID)
+	d.Monitor.Broadcast(MonitorEvent{Type: "ws_frame_paused", ID: sessionID, Ref: f.ID})
+	select {
+	case dec = <-p.decided:
+		d.Monitor.Broadcast(MonitorEvent{Type: "ws_frame_resumed", ID: sessionID, Ref: f.ID})
+		return dec, true
+	case <-d.Live.Done(sessionID):
+		return wsFrameDecision{}, false
+	}
+}
+
+// handleV1WSBreakpoints manages the WebSocket breakpoints, mirroring /_api/v1/mitm/rules:
+// GET lists; POST adds one; PUT replaces all ({items}) or, with ?id=…, updates one; DELETE ?id=…
+// removes one. Removing a breakpoint does not release the frames it holds.
+func (d *Deps) handleV1WSBreakpoints(w http.ResponseWriter, r *http.Request) {
+	serveRuleList(w, r, &d.WSBreakpoints.rules, "breakpoint")
+}
+
+// handleV1WSPaused lists the held frames (GET, ?sessionId=) and resolves one:
+// POST ?id=… {"action":"release"|"edit"|"drop","payload","encoding"}. "edit" forwards payload
+// instead of the original ("base64" encoding for binary frames).
+func (d *Deps) handleV1WSPaused(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		frameID := r.URL.Query().Get("id")
+		if frameID == "" {
+			writeError(w, http.StatusBadRequest, "MISSING_ID", "missing id", nil)
+			return
+		}
+		var in struct {
+			Action   string  `json:"action"`
+			Payload  *string `json:"payload"`
+			Encoding string  `json:"encoding"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+			return
+		}
+		var dec wsFrameDecision
+		switch in.Action {
+		case "release":
+		case "drop":
+			dec.drop = true
+		case "edit":
+			if in.Payload == nil {
+				writeError(w, http.StatusBadRequest, "BAD_VALUE", "edit needs a payload", nil)
+				return
+			}
+			dec.data = []byte(*in.Payload)
+			if in.Encoding == "base64" {
+				b, err := base64.StdEncoding.DecodeString(*in.Payload)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "BAD_VALUE", "payload is not valid base64", nil)
+					return
+				}
+				dec.data = b
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", "action must be release, edit or drop", nil)
+			return
+		}
+		if !d.WSBreakpoints.decide(frameID, dec) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "frame not paused", map[string]any{"id": frameID})
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use GET or POST", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": d.WSBreakpoints.Paused(r.URL.Query().Get("sessionId"))})
+}
@@ -2,7 +2,7 @@ package httpapi
 
 import (
 	"context"
-	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"net"
 	"net/http"
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 
@@ -20,6 +21,11 @@ import (
 )
 
 func (d *Deps) handleWSProxy(w http.ResponseWriter, r *http.Request) {
+	user, ok := d.authorizeProxy(w, r)
+	if !ok {
+		return
+	}
+	r = r.WithContext(withProxyUser(r.Context(), user))
 	tgt := r.URL.Query().Get("_target")
 	if tgt == "" {
 		if d.Cfg.DefaultTarget != "" {
@@ -55,6 +61,8 @@ func (d *Deps) handleWSProxy(w http.ResponseWriter, r *http.Request) {
 		ClientAddr: clientHost(r.RemoteAddr),
 		StartedAt:  time.Now().UTC(),
 		Kind:       "ws",
+		User:       user,
+		ClientID:   d.Clients.identify(d.clientOfRequest(r)),
 	}
 	if err := d.Svc.Create(r.Context(), sess); err != nil {
 		writeError(w, http.StatusInternalServerError, "SESSION_CREATE_FAILED", err.Error(), nil)
@@ -92,12 +100,26 @@ func (d *Deps) handleWSProxy(w http.ResponseWriter, r *http.Request) {
 	d.Logger.Info().Str("session", sessionID).Msg("network-debugger: client upgraded to WebSocket")
 
 	// Ограничиваем время рукопожатия/диала к апстриму, чтобы не вешать клиента при недоступном апстриме
+	dialScheme := "http"
+	if u.Scheme == "wss" {
+		dialScheme = "https"
+	}
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 10 * time.Second,
-		NetDialContext:   (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
-	}
-	if u.Scheme == "wss" && d.Cfg.InsecureTLS {
-		dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		// Upstream proxy (CONNECT/SOCKS5) is applied at TCP level; gorilla then does TLS + handshake on top
+		NetDialContext: d.Upstream.DialerFor(dialScheme),
+		// wss: TLS is set up by us (verification policy, client certificates)
+		NetDialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			tc, err := d.dialUpstreamTLS(ctx, network, addr, []string{"http/1.1"})
+			if err != nil {
+				return nil, err
+			}
+			if err := tc.HandshakeContext(ctx); err != nil {
+				_ = tc.Close()
+				return nil, err
+			}
+			return tc, nil
+		},
 	}
 	hdr := http.Header{}
 	// whitelist selected headers
@@ -120,6 +142,7 @@ func (d *Deps) handleWSProxy(w http.ResponseWriter, r *http.Request) {
 
 	upstreamConn, resp, err := dialer.Dial(u.String(), hdr)
 	if err != nil {
+		d.recordTLSFailure(sessionID, err)
 		// Get human-readable error message
 		errorCode, errorMessage := humanizeProxyError(err)
 
@@ -153,6 +176,8 @@ func (d *Deps) handleWSProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	d.Logger.Info().Str("session", sessionID).Str("upstream", u.String()).Msg("network-debugger: connected to upstream")
+	d.recordServerIP(sessionID, remoteIP(upstreamConn.UnderlyingConn()))
+	d.recordClientCert(sessionID, clientCertOf(upstreamConn.UnderlyingConn()))
 	// Register live session for API injection
 	if d.Live != nil {
 		d.Live.Register(sessionID, clientConn, upstreamConn)
@@ -194,70 +219,96 @@ func (d *Deps) pipe(sessionID string, src, dst *websocket.Conn, direction domain
 			lastErr = err
 			return
 		}
-		_ = dst.SetWriteDeadline(time.Now().Add(15 * time.Second))
-		if err := dst.WriteMessage(mt, data); err != nil {
+		opcode := opcodeFromType(mt)
+		fr := domain.Frame{Direction: direction, Opcode: opcode}
+		if ruleID := d.WSBreakpoints.match(sessionID, direction, opcode, data); ruleID != "" {
+			dec, ok := d.pauseWSFrame(sessionID, ruleID, direction, opcode, data)
+			if !ok {
+				return
+			}
+			if dec.drop {
+				fr.Dropped, fr.Size = true, len(data)
+				d.recordWSFrame(sessionID, fr, data, &loggedFirstUpstreamText)
+				continue
+			}
+			if dec.data != nil {
+				data, fr.Edited = dec.data, true
+			}
+		}
+		if err := d.Live.WriteMessage(sessionID, dst, mt, data); err != nil {
 			lastErr = err
 			return
 		}
 
-		// log frame
-		opcode := opcodeFromType(mt)
-		preview := buildPreview(opcode, data)
-		fr := domain.Frame{ID: id.New(), Ts: time.Now().UTC(), Direction: direction, Opcode: opcode, Size: len(data), Preview: preview}
-		_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
-		d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
-		d.Metrics.FramesTotal.WithLabelValues(string(direction), string(opcode)).Inc()
-
-		// best-effort Socket.IO event decoding for text frames
 		if !loggedFirst {
 			d.Logger.Info().Str("session", sessionID).Str("direction", string(direction)).Str("opcode", string(opcode)).Int("size", len(data)).Msg("network-debugger: first frame proxied")
 			loggedFirst = true
 		}
-		if opcode == domain.OpcodeText {
-			// Parse from raw text (not from preview), to preserve SIO prefixes 42/43
-			raw := strings.TrimSpace(string(data))
-			if direction == domain.DirectionUpstreamToClient && !loggedFirstUpstreamText {
-				// emit lightweight probe (no payload exposure)
-				// payload: {dir:"upstream", prefix:"<first 6>", len:n}
-				pref := raw
-				if len(pref) > 6 {
-					pref = pref[:6]
-				}
-				_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, domain.Event{
-					ID: id.New(), Ts: time.Now().UTC(), Namespace: "", Name: "sio_probe", AckID: nil,
-					ArgsPreview: "{\"dir\":\"upstream\",\"prefix\":\"" + pref + "\",\"len\":" + strconv.Itoa(len(raw)) + "}",
-					FrameIDs:    []string{fr.ID},
-				})
-				d.Monitor.Broadcast(MonitorEvent{Type: "sio_probe", ID: sessionID, Ref: pref})
-				loggedFirstUpstreamText = true
+		fr.Size = len(data)
+		d.recordWSFrame(sessionID, fr, data, &loggedFirstUpstreamText)
+	}
+}
+
+// recordWSMessage stores one WebSocket message as a frame and decodes Socket.IO events from text
+// frames. probed tracks the one-off "sio_probe" event of the upstream direction.
+func (d *Deps) recordWSMessage(sessionID string, direction domain.Direction, opcode domain.Opcode, data []byte, size int, probed *bool) {
+	d.recordWSFrame(sessionID, domain.Frame{Direction: direction, Opcode: opcode, Size: size}, data, probed)
+}
+
+// recordWSFrame is recordWSMessage for a frame carrying markers (edited, dropped, injected); ID,
+// Ts and Preview are filled in. Dropped frames are not decoded into Socket.IO events.
+func (d *Deps) recordWSFrame(sessionID string, fr domain.Frame, data []byte, probed *bool) {
+	direction, opcode := fr.Direction, fr.Opcode
+	fr.ID, fr.Ts, fr.Preview = id.New(), time.Now().UTC(), buildPreview(opcode, data)
+	_ = d.Svc.AddFrame(contextWithNoCancel(), sessionID, fr)
+	d.Monitor.Broadcast(MonitorEvent{Type: "frame_added", ID: sessionID, Ref: fr.ID})
+	d.Metrics.FramesTotal.WithLabelValues(string(direction), string(opcode)).Inc()
+
+	// best-effort Socket.IO event decoding for text frames
+	if opcode == domain.OpcodeText && !fr.Dropped {
+		// Parse from raw text (not from preview), to preserve SIO prefixes 42/43
+		raw := strings.TrimSpace(string(data))
+		if direction == domain.DirectionUpstreamToClient && !*probed {
+			// emit lightweight probe (no payload exposure)
+			// payload: {dir:"upstream", prefix:"<first 6>", len:n}
+			pref := raw
+			if len(pref) > 6 {
+				pref = pref[:6]
+			}
+			_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, domain.Event{
+				ID: id.New(), Ts: time.Now().UTC(), Namespace: "", Name: "sio_probe", AckID: nil,
+				ArgsPreview: "{\"dir\":\"upstream\",\"prefix\":\"" + pref + "\",\"len\":" + strconv.Itoa(len(raw)) + "}",
+				FrameIDs:    []string{fr.ID},
+			})
+			d.Monitor.Broadcast(MonitorEvent{Type: "sio_probe", ID: sessionID, Ref: pref})
+			*probed = true
+		}
+		if nsp, ev, argsJSON, ok := sio.ParseEvent(raw); ok {
+			var ack *int64
+			if a := tryExtractAckID(raw); a >= 0 {
+				ack = &a
 			}
-			if nsp, ev, argsJSON, ok := sio.ParseEvent(raw); ok {
-				var ack *int64
+			e := domain.Event{ID: id.New(), Ts: time.Now().UTC(), Namespace: nsp, Name: ev, AckID: ack, ArgsPreview: argsJSON, FrameIDs: []string{fr.ID}}
+			_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, e)
+			d.Monitor.Broadcast(MonitorEvent{Type: "event_added", ID: sessionID, Ref: e.ID})
+		} else {
+			// Fallbacks for common forms to avoid missing events in e2e
+			if strings.HasPrefix(raw, "43") {
 				if a := tryExtractAckID(raw); a >= 0 {
-					ack = &a
+					aa := a
+					e := domain.Event{ID: id.New(), Ts: time.Now().UTC(), Namespace: "", Name: "ack", AckID: &aa, ArgsPreview: "[]", FrameIDs: []string{fr.ID}}
+					_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, e)
+					d.Monitor.Broadcast(MonitorEvent{Type: "event_added", ID: sessionID, Ref: e.ID})
 				}
-				e := domain.Event{ID: id.New(), Ts: time.Now().UTC(), Namespace: nsp, Name: ev, AckID: ack, ArgsPreview: argsJSON, FrameIDs: []string{fr.ID}}
-				_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, e)
-				d.Monitor.Broadcast(MonitorEvent{Type: "event_added", ID: sessionID, Ref: e.ID})
-			} else {
-				// Fallbacks for common forms to avoid missing events in e2e
-				if strings.HasPrefix(raw, "43") {
+			} else if strings.HasPrefix(raw, "42/") || strings.HasPrefix(raw, "42[") || strings.HasPrefix(raw, "42,") || strings.HasPrefix(raw, "42") {
+				if nsp, ev, argsJSON, ok2 := sio.ParseEvent(raw); ok2 {
+					var ack *int64
 					if a := tryExtractAckID(raw); a >= 0 {
-						aa := a
-						e := domain.Event{ID: id.New(), Ts: time.Now().UTC(), Namespace: "", Name: "ack", AckID: &aa, ArgsPreview: "[]", FrameIDs: []string{fr.ID}}
-						_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, e)
-						d.Monitor.Broadcast(MonitorEvent{Type: "event_added", ID: sessionID, Ref: e.ID})
-					}
-				} else if strings.HasPrefix(raw, "42/") || strings.HasPrefix(raw, "42[") || strings.HasPrefix(raw, "42,") || strings.HasPrefix(raw, "42") {
-					if nsp, ev, argsJSON, ok2 := sio.ParseEvent(raw); ok2 {
-						var ack *int64
-						if a := tryExtractAckID(raw); a >= 0 {
-							ack = &a
-						}
-						e := domain.Event{ID: id.New(), Ts: time.Now().UTC(), Namespace: nsp, Name: ev, AckID: ack, ArgsPreview: argsJSON, FrameIDs: []string{fr.ID}}
-						_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, e)
-						d.Monitor.Broadcast(MonitorEvent{Type: "event_added", ID: sessionID, Ref: e.ID})
+						ack = &a
 					}
+					e := domain.Event{ID: id.New(), Ts: time.Now().UTC(), Namespace: nsp, Name: ev, AckID: ack, ArgsPreview: argsJSON, FrameIDs: []string{fr.ID}}
+					_ = d.Svc.AddEvent(contextWithNoCancel(), sessionID, e)
+					d.Monitor.Broadcast(MonitorEvent{Type: "event_added", ID: sessionID, Ref: e.ID})
 				}
 			}
 		}
@@ -325,13 +376,6 @@ func copyHeaderIfPresent(dst *http.Header, src http.Header, key string) {
 
 func strPtr(s string) *string { return &s }
 
-func clientHost(remote string) string {
-	if i := strings.LastIndexByte(remote, ':'); i > 0 {
-		return remote[:i]
-	}
-	return remote
-}
-
 // avoid context cancellation from HTTP request lifecycle for async logging
 func contextWithNoCancel() context.Context { return context.Background() }
 
@@ -374,35 +418,147 @@ func tryExtractAckID(s string) int64 {
 	return val
 }
 
-// handleWSSendText handles POST /api/sessions/{id}/ws/send with JSON body {direction, payload}
-// Minimal MVP for injecting text frames from UI.
-func (d *Deps) handleWSSendText(w http.ResponseWriter, r *http.Request) {
+// wsSessionAction returns the session id of POST /api/sessions/{id}/ws/{action}.
+func wsSessionAction(w http.ResponseWriter, r *http.Request, action string) (string, bool) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "use POST", nil)
-		return
+		return "", false
 	}
 	path := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
 	parts := strings.Split(path, "/")
-	if len(parts) < 3 || parts[1] != "ws" || parts[2] != "send" {
+	if len(parts) < 3 || parts[0] == "" || parts[1] != "ws" || parts[2] != action {
 		writeError(w, http.StatusNotFound, "NOT_FOUND", "resource not found", nil)
+		return "", false
+	}
+	return parts[0], true
+}
+
+// handleWSSend handles POST /api/sessions/{id}/ws/send and injects one frame into a live
+// /wsproxy session:
+//
+//	{direction, payload}                               — text (default)
+//	{direction, opcode:"binary", payload, encoding:"base64"}
+//	{direction, opcode:"ping"|"pong", payload}         — control payload up to 125 bytes
+//	{direction, opcode:"close", code, reason}          — close handshake (default code 1000)
+//
+// payload is decoded as base64 when encoding is "base64". Injected frames are recorded with
+// injected: true.
+func (d *Deps) handleWSSend(w http.ResponseWriter, r *http.Request) {
+	id, ok := wsSessionAction(w, r, "send")
+	if !ok {
 		return
 	}
-	id := parts[0]
 	var req struct {
 		Direction string `json:"direction"`
+		Opcode    string `json:"opcode"`
 		Payload   string `json:"payload"`
+		Encoding  string `json:"encoding"`
+		Code      int    `json:"code"`
+		Reason    string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
 		return
 	}
-	if d.Live == nil {
-		writeError(w, http.StatusServiceUnavailable, "LIVE_UNAVAILABLE", "live not ready", nil)
+	data := []byte(req.Payload)
+	if req.Encoding == "base64" {
+		b, err := base64.StdEncoding.DecodeString(req.Payload)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", "payload is not valid base64", nil)
+			return
+		}
+		data = b
+	}
+	opcode := domain.Opcode(req.Opcode)
+	if opcode == "" {
+		opcode = domain.OpcodeText
+	}
+	var err error
+	switch opcode {
+	case domain.OpcodeText:
+		if !utf8.Valid(data) {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", "text payload must be UTF-8", nil)
+			return
+		}
+		err = d.Live.Send(id, req.Direction, websocket.TextMessage, data)
+	case domain.OpcodeBinary:
+		err = d.Live.Send(id, req.Direction, websocket.BinaryMessage, data)
+	case domain.OpcodePing, domain.OpcodePong:
+		if len(data) > 125 {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", "control payload exceeds 125 bytes", nil)
+			return
+		}
+		mt := websocket.PingMessage
+		if opcode == domain.OpcodePong {
+			mt = websocket.PongMessage
+		}
+		err = d.Live.Send(id, req.Direction, mt, data)
+	case domain.OpcodeClose:
+		if req.Code == 0 {
+			req.Code = websocket.CloseNormalClosure
+		}
+		if !sendableCloseCode(req.Code) || len(req.Reason) > 123 {
+			writeError(w, http.StatusBadRequest, "BAD_VALUE", "close code must be 1000-1003, 1007-1014 or 3000-4999 and reason at most 123 bytes", nil)
+			return
+		}
+		data = websocket.FormatCloseMessage(req.Code, req.Reason)
+		err = d.Live.SendClose(id, req.Direction, req.Code, req.Reason)
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_VALUE", "opcode must be text, binary, ping, pong or close", nil)
 		return
 	}
-	if err := d.Live.SendText(id, req.Direction, req.Payload); err != nil {
+	if err != nil {
 		writeError(w, http.StatusBadRequest, "SEND_FAILED", err.Error(), nil)
 		return
 	}
+	d.recordInjectedFrame(id, domain.Direction(req.Direction), opcode, data)
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// sendableCloseCode reports whether code may appear in a close frame (RFC 6455 §7.4): 1004-1006
+// and 1015 are reserved or local-only, 1016-2999 are unassigned.
+func sendableCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+// handleWSEmit handles POST /api/sessions/{id}/ws/emit: a Socket.IO event
+// {direction, namespace, event, args: [...], ackId?} sent as a "42" text frame.
+func (d *Deps) handleWSEmit(w http.ResponseWriter, r *http.Request) {
+	id, ok := wsSessionAction(w, r, "emit")
+	if !ok {
+		return
+	}
+	var req struct {
+		Direction string            `json:"direction"`
+		Namespace string            `json:"namespace"`
+		Event     string            `json:"event"`
+		Args      []json.RawMessage `json:"args"`
+		AckID     *int64            `json:"ackId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_JSON", "invalid json", nil)
+		return
+	}
+	packet, err := sio.EncodeEvent(req.Namespace, req.Event, req.Args, req.AckID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_VALUE", err.Error(), nil)
+		return
+	}
+	if err := d.Live.SendText(id, req.Direction, packet); err != nil {
+		writeError(w, http.StatusBadRequest, "SEND_FAILED", err.Error(), nil)
+		return
+	}
+	d.recordInjectedFrame(id, domain.Direction(req.Direction), domain.OpcodeText, []byte(packet))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordInjectedFrame records a frame sent via the API (decoded into Socket.IO events like
+// proxied ones, without the upstream probe).
+func (d *Deps) recordInjectedFrame(sessionID string, dir domain.Direction, opcode domain.Opcode, data []byte) {
+	probed := true
+	d.recordWSFrame(sessionID, domain.Frame{Direction: dir, Opcode: opcode, Size: len(data), Injected: true}, data, &probed)
+}
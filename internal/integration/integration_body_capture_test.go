@@ -0,0 +1,125 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+func TestBodyCapture_TeeNeverTruncatesTraffic(t *testing.T) {
+	t.Parallel()
+	reqPayload := bytes.Repeat([]byte("q"), 3000)
+	respPayload := bytes.Repeat([]byte("r"), 5000)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Received", strconv.Itoa(len(b)))
+		_, _ = w.Write(respPayload)
+	}))
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{CaptureBodies: true, BodyMaxBytes: 1024, BodySpoolDir: t.TempDir()})
+	defer app.Close()
+
+	resp, err := app.Client().Post(app.URL+"/httpproxy/?_target="+url.QueryEscape(upstream.URL), "application/octet-stream", bytes.NewReader(reqPayload))
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("X-Received") != "3000" {
+		t.Fatalf("upstream received %s bytes, want 3000", resp.Header.Get("X-Received"))
+	}
+	if !bytes.Equal(got, respPayload) {
+		t.Fatalf("client received %d bytes, want %d", len(got), len(respPayload))
+	}
+
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=1")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	if len(list.Items) != 1 {
+		t.Fatalf("expected one session, got %d", len(list.Items))
+	}
+	var tx struct {
+		ReqBodyFile       string `json:"reqBodyFile"`
+		RespBodyFile      string `json:"respBodyFile"`
+		ReqBodyTruncated  bool   `json:"reqBodyTruncated"`
+		RespBodyTruncated bool   `json:"respBodyTruncated"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rt, err := app.Client().Get(app.URL + "/api/sessions/" + list.Items[0].ID + "/http")
+		if err != nil {
+			t.Fatalf("http list: %v", err)
+		}
+		var out struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		_ = json.NewDecoder(rt.Body).Decode(&out)
+		rt.Body.Close()
+		if len(out.Items) == 1 {
+			_ = json.Unmarshal(out.Items[0], &tx)
+			if tx.RespBodyFile != "" {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("captured bodies not recorded: %+v", tx)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !tx.ReqBodyTruncated || !tx.RespBodyTruncated {
+		t.Fatalf("expected truncation flags: %+v", tx)
+	}
+	for _, f := range []string{tx.ReqBodyFile, tx.RespBodyFile} {
+		st, err := os.Stat(f)
+		if err != nil || st.Size() != 1024 {
+			t.Fatalf("spool %s: size=%v err=%v", f, st, err)
+		}
+	}
+}
+
+func TestBodyCapture_ChunkedRequestSizeWithoutSpooling(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	// a reader of unknown length makes the client send the body chunked (ContentLength -1)
+	body := io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("c"), 70000)))
+	resp, err := app.Client().Post(app.URL+"/httpproxy/up?_target="+url.QueryEscape(upstream.URL), "text/plain", body)
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	resp.Body.Close()
+
+	sess := lastSession(t, app, "http")
+	var txs struct {
+		Items []struct {
+			ReqSize int `json:"reqSize"`
+		} `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/api/sessions/"+sess.ID+"/http", "", &txs)
+	if len(txs.Items) != 1 || txs.Items[0].ReqSize != 70000 {
+		t.Fatalf("chunked request size not counted: %+v", txs)
+	}
+}
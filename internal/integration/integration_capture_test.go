@@ -0,0 +1,80 @@
+package integration
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestForwardProxy_CapturesTransactionsAndErrors(t *testing.T) {
+	t.Parallel()
+	upstream, upstreamURL := startUpstreamHTTP(t)
+	defer upstream.Close()
+	app, _ := startHTTPApp(t)
+	defer app.Close()
+
+	// a port nobody listens on
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "http://" + ln.Addr().String()
+	_ = ln.Close()
+
+	proxyURL, _ := url.Parse(app.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 5 * time.Second}
+	for _, u := range []string{upstreamURL + "/get?q=1", deadURL + "/x"} {
+		resp, err := client.Get(u)
+		if err != nil {
+			t.Fatalf("get %s: %v", u, err)
+		}
+		resp.Body.Close()
+	}
+
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=10")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID     string `json:"id"`
+			Kind   string `json:"kind"`
+			Via    string `json:"via"`
+			Target string `json:"target"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	if len(list.Items) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", list.Items)
+	}
+	for _, s := range list.Items {
+		if s.Kind != "http" || s.Via != "forward" {
+			t.Fatalf("unexpected session: %+v", s)
+		}
+		rh, err := app.Client().Get(app.URL + "/api/sessions/" + s.ID + "/http")
+		if err != nil {
+			t.Fatalf("http txs: %v", err)
+		}
+		var txs struct {
+			Items []struct {
+				Status    int    `json:"status"`
+				Error     string `json:"error"`
+				ErrorCode string `json:"errorCode"`
+			} `json:"items"`
+		}
+		_ = json.NewDecoder(rh.Body).Decode(&txs)
+		rh.Body.Close()
+		if len(txs.Items) != 1 {
+			t.Fatalf("session %s: expected one transaction, got %+v", s.Target, txs.Items)
+		}
+		tx := txs.Items[0]
+		if s.Target == deadURL+"/x" {
+			if tx.ErrorCode == "" || tx.Error == "" {
+				t.Fatalf("failed exchange not classified: %+v", tx)
+			}
+		} else if tx.Status != http.StatusOK || tx.ErrorCode != "" {
+			t.Fatalf("unexpected tx: %+v", tx)
+		}
+	}
+}
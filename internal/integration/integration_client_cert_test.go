@@ -0,0 +1,112 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+// newTestClientCert returns a self-signed client certificate (PEM) and a pool trusting it.
+func newTestClientCert(t *testing.T, cn string) (certPEM, keyPEM []byte, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true, BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cert: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(leaf)
+	kb, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), pool
+}
+
+func TestClientCert_PresentedToMatchingUpstream(t *testing.T) {
+	t.Parallel()
+	certPEM, keyPEM, pool := newTestClientCert(t, "debugger-client")
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello " + r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	upstream.StartTLS()
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{InsecureTLS: true})
+	defer app.Close()
+
+	in, _ := json.Marshal(map[string]any{"patterns": []string{"127.0.0.1"}, "certPem": string(certPEM), "keyPem": string(keyPEM)})
+	rc, err := app.Client().Post(app.URL+"/_api/v1/client-certs", "application/json", bytes.NewReader(in))
+	if err != nil {
+		t.Fatalf("add cert: %v", err)
+	}
+	var certs struct {
+		Items []struct {
+			ID          string `json:"id"`
+			Fingerprint string `json:"fingerprint"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(rc.Body).Decode(&certs)
+	rc.Body.Close()
+	if rc.StatusCode != http.StatusOK || len(certs.Items) != 1 {
+		t.Fatalf("add cert: status=%d items=%+v", rc.StatusCode, certs.Items)
+	}
+
+	resp, err := app.Client().Get(app.URL + "/httpproxy/?_target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(b) != "hello debugger-client" {
+		t.Fatalf("unexpected upstream reply: %d %q", resp.StatusCode, b)
+	}
+
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=1")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ClientCert *struct {
+				Requested   bool   `json:"requested"`
+				CertID      string `json:"certId"`
+				Fingerprint string `json:"fingerprint"`
+			} `json:"clientCert"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	if len(list.Items) != 1 || list.Items[0].ClientCert == nil {
+		t.Fatalf("client certificate exchange not recorded: %+v", list.Items)
+	}
+	cc := list.Items[0].ClientCert
+	if !cc.Requested || cc.CertID != certs.Items[0].ID || cc.Fingerprint != certs.Items[0].Fingerprint {
+		t.Fatalf("unexpected client cert record: %+v", cc)
+	}
+}
@@ -0,0 +1,175 @@
+package integration
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"network-debugger/internal/domain"
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+type clientList struct {
+	Items []httpapi.Client `json:"items"`
+}
+
+func findClient(t *testing.T, app *httptest.Server, match func(httpapi.Client) bool) httpapi.Client {
+	t.Helper()
+	var list clientList
+	apiJSON(t, app, http.MethodGet, "/_api/v1/clients", "", &list)
+	for _, c := range list.Items {
+		if match(c) {
+			return c
+		}
+	}
+	t.Fatalf("client not found in %+v", list.Items)
+	return httpapi.Client{}
+}
+
+func TestClients_IdentifiedNamedAndThrottled(t *testing.T) {
+	t.Parallel()
+	var leaked atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Debugger-Client") != "" {
+			leaked.Store(true)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+	client := proxiedClient(t, app, nil)
+	get := func(path, device string) time.Duration {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, upstream.URL+path, nil)
+		if device != "" {
+			req.Header.Set("X-Debugger-Client", device)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return time.Since(start)
+	}
+
+	get("/pixel", "pixel-7")
+	get("/anon", "")
+	pixel := findClient(t, app, func(c httpapi.Client) bool { return c.Source == "header" && c.Key == "pixel-7" })
+	anon := findClient(t, app, func(c httpapi.Client) bool { return c.Source == "ip" && c.Key == "127.0.0.1" })
+	if pixel.ID == anon.ID || pixel.IP != "127.0.0.1" {
+		t.Fatalf("unexpected clients: %+v %+v", pixel, anon)
+	}
+	if leaked.Load() {
+		t.Fatalf("X-Debugger-Client leaked upstream")
+	}
+
+	var list struct {
+		Items []domain.Session `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/_api/v1/sessions?clientId="+pixel.ID, "", &list)
+	if len(list.Items) != 1 || list.Items[0].Target != upstream.URL+"/pixel" || list.Items[0].ClientID != pixel.ID {
+		t.Fatalf("unexpected sessions for %s: %+v", pixel.ID, list.Items)
+	}
+
+	if code := apiJSON(t, app, http.MethodPut, "/_api/v1/clients?id="+pixel.ID, `{"settings":{"throttle":"dial-up"}}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("unknown profile: expected 400, got %d", code)
+	}
+	if code := apiJSON(t, app, http.MethodPut, "/_api/v1/clients?id=c-missing", `{"name":"x"}`, nil); code != http.StatusNotFound {
+		t.Fatalf("unknown client: expected 404, got %d", code)
+	}
+	apiJSON(t, app, http.MethodPut, "/_api/v1/clients?id="+pixel.ID, `{"name":"QA Pixel","settings":{"throttle":"lte"}}`, nil)
+	pixel = findClient(t, app, func(c httpapi.Client) bool { return c.ID == pixel.ID })
+	if pixel.Name != "QA Pixel" || pixel.Settings.Throttle != "lte" {
+		t.Fatalf("client not updated: %+v", pixel)
+	}
+	if d := get("/slow", "pixel-7"); d < 70*time.Millisecond {
+		t.Fatalf("throttled request took only %v", d)
+	}
+
+	if code := apiJSON(t, app, http.MethodDelete, "/_api/v1/clients?id="+anon.ID, "", nil); code != http.StatusOK {
+		t.Fatalf("delete: %d", code)
+	}
+	if code := apiJSON(t, app, http.MethodDelete, "/_api/v1/clients?id="+anon.ID, "", nil); code != http.StatusNotFound {
+		t.Fatalf("second delete: expected 404, got %d", code)
+	}
+}
+
+func TestClients_MITMOverride(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	app, _ := startMITMApp(t, config.Config{InsecureTLS: true}, false)
+	defer app.Close()
+	client := proxiedClient(t, app, nil)
+	// the tunnel is attributed by its CONNECT request; the requests inside it follow
+	client.Transport.(*http.Transport).ProxyConnectHeader = http.Header{"X-Debugger-Client": {"pixel-7"}}
+	resp, err := client.Get(upstream.URL + "/first")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if txs := mitmTxs(t, app); len(txs) != 1 {
+		t.Fatalf("expected the first request to be intercepted, got %d", len(txs))
+	}
+	c := findClient(t, app, func(c httpapi.Client) bool { return c.Key == "pixel-7" })
+	if s := lastSession(t, app, "http"); s.ClientID != c.ID {
+		t.Fatalf("intercepted session attributed to %q, want %q", s.ClientID, c.ID)
+	}
+
+	apiJSON(t, app, http.MethodPut, "/_api/v1/clients?id="+c.ID, `{"settings":{"mitm":"passthrough"}}`, nil)
+	resp, err = client.Get(upstream.URL + "/second")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if s := lastSession(t, app, "tunnel"); s.Tunnel == nil || s.Tunnel.MITMSkipped != "client" || s.ClientID != c.ID {
+		t.Fatalf("expected a client passthrough tunnel, got %+v", s)
+	}
+}
+
+func TestClients_IPv6ClientAddr(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+	v6 := httptest.NewUnstartedServer(app.Config.Handler)
+	v6.Listener.Close()
+	v6.Listener = ln
+	v6.Start()
+	defer v6.Close()
+
+	resp, err := v6.Client().Get(v6.URL + "/httpproxy/v6?_target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	c := findClient(t, app, func(c httpapi.Client) bool { return c.Source == "ip" })
+	if c.Key != "::1" || c.IP != "::1" {
+		t.Fatalf("unexpected IPv6 client: %+v", c)
+	}
+	var list struct {
+		Items []domain.Session `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/_api/v1/sessions?clientId="+c.ID, "", &list)
+	if len(list.Items) != 1 || list.Items[0].ClientAddr != "::1" {
+		t.Fatalf("unexpected sessions: %+v", list.Items)
+	}
+}
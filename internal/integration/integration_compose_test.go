@@ -0,0 +1,159 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"network-debugger/internal/domain"
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+func TestCompose_MultipartAndRedirectFollow(t *testing.T) {
+	t.Parallel()
+	var gotFile, gotField, gotMethod string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upload":
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			gotField = r.FormValue("title")
+			f, _, err := r.FormFile("doc")
+			if err == nil {
+				b, _ := io.ReadAll(f)
+				gotFile = string(b)
+			}
+			http.Redirect(w, r, "/done", http.StatusSeeOther)
+		case "/done":
+			gotMethod = r.Method
+			_, _ = w.Write([]byte("finished"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	in, _ := json.Marshal(map[string]any{
+		"method": "POST",
+		"url":    upstream.URL + "/upload",
+		"body": map[string]any{
+			"type": "multipart",
+			"multipart": map[string]any{
+				"fields": []map[string]string{{"name": "title", "value": "report"}},
+				"files":  []map[string]string{{"name": "doc", "filename": "a.txt", "contentType": "text/plain", "contentBase64": base64.StdEncoding.EncodeToString([]byte("hello file"))}},
+			},
+		},
+		"options": map[string]any{"followRedirects": true},
+	})
+	creq, _ := http.NewRequest(http.MethodPost, app.URL+"/_api/v1/compose", bytes.NewReader(in))
+	creq.Header.Set("Content-Type", "application/json")
+	creq.Header.Set("X-Debugger-Client", "qa-laptop")
+	resp, err := app.Client().Do(creq)
+	if err != nil {
+		t.Fatalf("compose: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("compose status: %d", resp.StatusCode)
+	}
+	var out struct {
+		SessionID  string   `json:"sessionId"`
+		SessionIDs []string `json:"sessionIds"`
+		Status     int      `json:"status"`
+		Body       string   `json:"body"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	if out.Status != http.StatusOK || out.Body != "finished" || len(out.SessionIDs) != 2 || out.SessionID != out.SessionIDs[1] {
+		t.Fatalf("unexpected compose result: %+v", out)
+	}
+	if gotField != "report" || gotFile != "hello file" || gotMethod != http.MethodGet {
+		t.Fatalf("upstream saw field=%q file=%q method=%q", gotField, gotFile, gotMethod)
+	}
+
+	r, err := app.Client().Get(app.URL + "/api/sessions/" + out.SessionIDs[0] + "/http")
+	if err != nil {
+		t.Fatalf("http list: %v", err)
+	}
+	defer r.Body.Close()
+	var txs struct {
+		Items []struct {
+			Status int `json:"status"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&txs)
+	if len(txs.Items) != 1 || txs.Items[0].Status != http.StatusSeeOther {
+		t.Fatalf("first hop not captured: %+v", txs)
+	}
+
+	rs, err := app.Client().Get(app.URL + "/api/sessions/" + out.SessionIDs[1])
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+	defer rs.Body.Close()
+	var hop struct {
+		ChainID      string `json:"chainId"`
+		RedirectFrom string `json:"redirectFrom"`
+		ClientID     string `json:"clientId"`
+	}
+	_ = json.NewDecoder(rs.Body).Decode(&hop)
+	if hop.ChainID != out.SessionIDs[0] || hop.RedirectFrom != out.SessionIDs[0] {
+		t.Fatalf("followed hop not linked: %+v", hop)
+	}
+	// both hops belong to the caller, so ?clientId= finds them
+	c := findClient(t, app, func(c httpapi.Client) bool { return c.Key == "qa-laptop" })
+	var mine struct {
+		Items []domain.Session `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/_api/v1/sessions?clientId="+c.ID, "", &mine)
+	if len(mine.Items) != 2 || hop.ClientID != c.ID {
+		t.Fatalf("composed sessions not attributed to %s: %+v", c.ID, mine.Items)
+	}
+}
+
+func TestCompose_SharesCapturePipeline(t *testing.T) {
+	t.Parallel()
+	var via, xff string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		via, xff = r.Header.Get("Via"), r.Header.Get("X-Forwarded-For")
+		_, _ = w.Write([]byte("spooled response"))
+	}))
+	defer upstream.Close()
+
+	app, _ := startHTTPAppWithConfig(t, config.Config{CaptureBodies: true, BodyMaxBytes: 1 << 20, BodySpoolDir: t.TempDir()})
+	defer app.Close()
+
+	var out struct {
+		SessionID string `json:"sessionId"`
+		Body      string `json:"body"`
+	}
+	in := `{"method":"POST","url":"` + upstream.URL + `/x","body":{"type":"raw","raw":"ping"}}`
+	if code := apiJSON(t, app, http.MethodPost, "/_api/v1/compose", in, &out); code != http.StatusOK || out.Body != "spooled response" {
+		t.Fatalf("compose: %d %+v", code, out)
+	}
+	// debugger-issued requests carry no forwarding headers
+	if via != "" || xff != "" {
+		t.Fatalf("upstream saw Via=%q X-Forwarded-For=%q", via, xff)
+	}
+	var txs struct {
+		Items []struct {
+			ReqSize      int    `json:"reqSize"`
+			RespSize     int    `json:"respSize"`
+			ReqBodyFile  string `json:"reqBodyFile"`
+			RespBodyFile string `json:"respBodyFile"`
+		} `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/api/sessions/"+out.SessionID+"/http", "", &txs)
+	if len(txs.Items) != 1 || txs.Items[0].ReqSize != 4 || txs.Items[0].RespSize != len("spooled response") || txs.Items[0].ReqBodyFile == "" || txs.Items[0].RespBodyFile == "" {
+		t.Fatalf("composed exchange not captured like proxied traffic: %+v", txs)
+	}
+}
@@ -0,0 +1,85 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+func TestDNSOverride_RuntimeOverrideRoutesAndRecordsIP(t *testing.T) {
+	t.Parallel()
+	var gotHost string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		_, _ = w.Write([]byte("overridden"))
+	}))
+	defer upstream.Close()
+	upURL, _ := url.Parse(upstream.URL)
+
+	app, _ := startHTTPAppWithConfig(t, config.Config{UpstreamProxy: "DIRECT"})
+	defer app.Close()
+
+	in, _ := json.Marshal(map[string]string{"host": "api.prod.example.test", "ip": "127.0.0.1"})
+	resp, err := app.Client().Post(app.URL+"/_api/v1/dns", "application/json", bytes.NewReader(in))
+	if err != nil {
+		t.Fatalf("dns post: %v", err)
+	}
+	var dns struct {
+		Overrides map[string]string `json:"overrides"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&dns)
+	resp.Body.Close()
+	if dns.Overrides["api.prod.example.test"] != "127.0.0.1" {
+		t.Fatalf("override not stored: %+v", dns)
+	}
+
+	target := "http://api.prod.example.test:" + upURL.Port()
+	resp, err = app.Client().Get(app.URL + "/httpproxy/ping?_target=" + url.QueryEscape(target))
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "overridden" {
+		t.Fatalf("unexpected body %q (status %d)", body, resp.StatusCode)
+	}
+	if gotHost != "api.prod.example.test:"+upURL.Port() {
+		t.Fatalf("Host header rewritten: %q", gotHost)
+	}
+
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=10")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID       string `json:"id"`
+			ServerIP string `json:"serverIp"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	if len(list.Items) != 1 || list.Items[0].ServerIP != "127.0.0.1" {
+		t.Fatalf("session serverIp not recorded: %+v", list.Items)
+	}
+	rt, err := app.Client().Get(app.URL + "/api/sessions/" + list.Items[0].ID + "/http")
+	if err != nil {
+		t.Fatalf("http list: %v", err)
+	}
+	defer rt.Body.Close()
+	var txs struct {
+		Items []struct {
+			ServerIPAddress string `json:"serverIPAddress"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(rt.Body).Decode(&txs)
+	if len(txs.Items) != 1 || txs.Items[0].ServerIPAddress != "127.0.0.1" {
+		t.Fatalf("tx serverIPAddress not recorded: %+v", txs.Items)
+	}
+}
@@ -0,0 +1,118 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+func TestHTTPTimings_ReceivePhaseCoversBody(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first,"))
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("last"))
+	}))
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	resp, err := app.Client().Get(app.URL + "/httpproxy/?_target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "first,last" {
+		t.Fatalf("unexpected body %q", b)
+	}
+
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=1")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	if len(list.Items) != 1 {
+		t.Fatalf("expected one session, got %d", len(list.Items))
+	}
+	sid := list.Items[0].ID
+
+	var tx struct {
+		RespSize int `json:"respSize"`
+		Timings  struct {
+			Connect int64 `json:"connectMs"`
+			Wait    int64 `json:"waitMs"`
+			Receive int64 `json:"receiveMs"`
+			TTFB    int64 `json:"ttfbMs"`
+			Total   int64 `json:"totalMs"`
+		} `json:"timings"`
+	}
+	// final timings are stored right after the body was copied; allow the handler to return
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rt, err := app.Client().Get(app.URL + "/api/sessions/" + sid + "/http")
+		if err != nil {
+			t.Fatalf("http list: %v", err)
+		}
+		var out struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		_ = json.NewDecoder(rt.Body).Decode(&out)
+		rt.Body.Close()
+		if len(out.Items) == 1 {
+			_ = json.Unmarshal(out.Items[0], &tx)
+			if tx.Timings.Receive >= 150 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("receive phase not recorded: %+v", tx)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if tx.Timings.Total < tx.Timings.TTFB+tx.Timings.Receive {
+		t.Fatalf("total must cover ttfb and receive: %+v", tx.Timings)
+	}
+	if tx.RespSize != len("first,last") {
+		t.Fatalf("expected streamed size to be recorded, got %d", tx.RespSize)
+	}
+
+	rh, err := app.Client().Get(app.URL + "/api/sessions/" + sid + "/har")
+	if err != nil {
+		t.Fatalf("har: %v", err)
+	}
+	var har struct {
+		Log struct {
+			Entries []struct {
+				ServerIPAddress string `json:"serverIPAddress"`
+				Timings         struct {
+					Connect int64 `json:"connect"`
+					Receive int64 `json:"receive"`
+					SSL     int64 `json:"ssl"`
+				} `json:"timings"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	_ = json.NewDecoder(rh.Body).Decode(&har)
+	rh.Body.Close()
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("expected one HAR entry, got %d", len(har.Log.Entries))
+	}
+	e := har.Log.Entries[0]
+	if e.Timings.Receive < 150 || e.Timings.SSL != -1 || e.ServerIPAddress != "127.0.0.1" {
+		t.Fatalf("unexpected HAR entry: %+v", e)
+	}
+}
@@ -0,0 +1,175 @@
+package integration
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+type mitmCAStatus struct {
+	HasCA bool `json:"hasCA"`
+	CA    *struct {
+		Fingerprint string `json:"fingerprint"`
+		KeyType     string `json:"keyType"`
+	} `json:"ca"`
+	Next *struct {
+		Fingerprint string     `json:"fingerprint"`
+		ActivateAt  *time.Time `json:"activateAt"`
+	} `json:"next"`
+	Persistent bool `json:"persistent"`
+}
+
+func getMITMStatus(t *testing.T, app *httptest.Server) mitmCAStatus {
+	t.Helper()
+	r, err := app.Client().Get(app.URL + "/_api/v1/mitm/status")
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	defer r.Body.Close()
+	var st mitmCAStatus
+	_ = json.NewDecoder(r.Body).Decode(&st)
+	return st
+}
+
+func getBody(t *testing.T, app *httptest.Server, path string) (int, []byte) {
+	t.Helper()
+	r, err := app.Client().Get(app.URL + path)
+	if err != nil {
+		t.Fatalf("get %s: %v", path, err)
+	}
+	defer r.Body.Close()
+	b, _ := io.ReadAll(r.Body)
+	return r.StatusCode, b
+}
+
+func TestMITM_CAPersistedAndExported(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "ca")
+	app, _ := startHTTPAppWithConfig(t, config.Config{MITMCADir: dir})
+	resp, err := app.Client().Post(app.URL+"/_api/v1/mitm/ca/generate", "application/json", strings.NewReader(`{"keyType":"ecdsa"}`))
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	var gen map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&gen)
+	resp.Body.Close()
+	if _, leaked := gen["keyPEM"]; leaked || gen["certPEM"] == "" || gen["persisted"] != true {
+		t.Fatalf("unexpected generate response: %v", gen)
+	}
+	st := getMITMStatus(t, app)
+	if !st.HasCA || st.CA == nil || st.CA.KeyType != "ecdsa" || !st.Persistent {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	// restrictive permissions on disk
+	if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0o700 {
+		t.Fatalf("ca dir: %v %v", fi, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "ca-key.pem")); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("ca key: %v %v", fi, err)
+	}
+
+	// exports
+	_, pemBody := getBody(t, app, "/_api/v1/mitm/ca")
+	if strings.Contains(string(pemBody), "PRIVATE KEY") || !strings.Contains(string(pemBody), "BEGIN CERTIFICATE") {
+		t.Fatalf("unexpected pem export: %s", pemBody)
+	}
+	_, withKey := getBody(t, app, "/_api/v1/mitm/ca?includeKey=1")
+	if !strings.Contains(string(withKey), "PRIVATE KEY") {
+		t.Fatalf("key not included on request")
+	}
+	_, der := getBody(t, app, "/_api/v1/mitm/ca?format=der")
+	blk, _ := pem.Decode(pemBody)
+	if c, err := x509.ParseCertificate(der); err != nil || string(c.Raw) != string(blk.Bytes) {
+		t.Fatalf("der export: %v", err)
+	}
+	_, p12 := getBody(t, app, "/_api/v1/mitm/ca?format=p12&password=pw")
+	if certs, err := pkcs12.DecodeTrustStore(p12, "pw"); err != nil || len(certs) != 1 {
+		t.Fatalf("p12 trust store: %v", err)
+	}
+	_, p12Key := getBody(t, app, "/_api/v1/mitm/ca?format=p12&includeKey=1&password=pw")
+	if key, _, err := pkcs12.Decode(p12Key, "pw"); err != nil || key == nil {
+		t.Fatalf("p12 with key: %v", err)
+	}
+	if code, _ := getBody(t, app, "/_api/v1/mitm/ca?format=der&includeKey=1"); code != http.StatusBadRequest {
+		t.Fatalf("der with key: expected 400, got %d", code)
+	}
+	app.Close()
+
+	// a restart picks the stored CA up again
+	app2, _ := startHTTPAppWithConfig(t, config.Config{MITMCADir: dir})
+	defer app2.Close()
+	st2 := getMITMStatus(t, app2)
+	if st2.CA == nil || st2.CA.Fingerprint != st.CA.Fingerprint {
+		t.Fatalf("CA not restored after restart: %+v", st2)
+	}
+}
+
+func TestMITM_CARotationGracePeriod(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	app, _ := startHTTPAppWithConfig(t, config.Config{MITMCADir: dir})
+	defer app.Close()
+	if r, err := app.Client().Post(app.URL+"/_api/v1/mitm/ca/rotate", "application/json", nil); err != nil || r.StatusCode != http.StatusConflict {
+		t.Fatalf("rotate without CA: %v %v", r, err)
+	}
+	r, err := app.Client().Post(app.URL+"/_api/v1/mitm/ca/generate", "application/json", nil)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	r.Body.Close()
+	old := getMITMStatus(t, app).CA.Fingerprint
+
+	r, err = app.Client().Post(app.URL+"/_api/v1/mitm/ca/rotate", "application/json", strings.NewReader(`{"graceSeconds":1,"includeKey":true}`))
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	var rot map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&rot)
+	r.Body.Close()
+	if rot["keyPEM"] == nil || rot["activateAt"] == nil {
+		t.Fatalf("unexpected rotate response: %v", rot)
+	}
+
+	// during the grace period the old CA keeps issuing and the next one is downloadable
+	st := getMITMStatus(t, app)
+	if st.CA.Fingerprint != old || st.Next == nil || st.Next.ActivateAt == nil {
+		t.Fatalf("unexpected status during grace: %+v", st)
+	}
+	if code, _ := getBody(t, app, "/_api/v1/mitm/ca?which=next"); code != http.StatusOK {
+		t.Fatalf("next CA download: %d", code)
+	}
+	// a restart during the grace period keeps the pending rotation
+	app2, _ := startHTTPAppWithConfig(t, config.Config{MITMCADir: dir})
+	defer app2.Close()
+	if st2 := getMITMStatus(t, app2); st2.CA.Fingerprint != old || st2.Next == nil || st2.Next.Fingerprint != st.Next.Fingerprint {
+		t.Fatalf("pending rotation not restored: %+v", st2)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		st = getMITMStatus(t, app)
+		if st.Next == nil && st.CA.Fingerprint != old {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rotation did not activate: %+v", st)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if code, _ := getBody(t, app, "/_api/v1/mitm/ca?which=next"); code != http.StatusNotFound {
+		t.Fatalf("next CA after activation: expected 404, got %d", code)
+	}
+}
@@ -0,0 +1,102 @@
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+func TestMITM_ECDSACertAuthority(t *testing.T) {
+	t.Parallel()
+	certPEM, keyPEM, err := httpapi.GenerateDevCAECDSA("ecdsa test CA", 1)
+	if err != nil {
+		t.Fatalf("generate CA: %v", err)
+	}
+	ca, err := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("load ECDSA CA: %v", err)
+	}
+	leaf, err := ca.IssueFor("api.example.test:443")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if _, ok := leaf.PrivateKey.(*ecdsa.PrivateKey); !ok || leaf.Leaf == nil || leaf.Leaf.DNSNames[0] != "api.example.test" {
+		t.Fatalf("unexpected leaf: %T %+v", leaf.PrivateKey, leaf.Leaf)
+	}
+	blk, _ := pem.Decode(certPEM)
+	caCert, err := x509.ParseCertificate(blk.Bytes)
+	if err != nil {
+		t.Fatalf("parse CA: %v", err)
+	}
+	if err := leaf.Leaf.CheckSignatureFrom(caCert); err != nil {
+		t.Fatalf("leaf not signed by CA: %v", err)
+	}
+
+	// end to end through the MITM bridge
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	app, client := startMITMAppWithCA(t, config.Config{InsecureTLS: true}, certPEM, keyPEM, true)
+	defer app.Close()
+	resp, err := client.Get(upstream.URL + "/")
+	if err != nil {
+		t.Fatalf("get through ECDSA MITM: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "ok" {
+		t.Fatalf("unexpected body %q", b)
+	}
+}
+
+func TestMITM_LeafIssuanceIsSharedAndCached(t *testing.T) {
+	t.Parallel()
+	certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+	ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+
+	// concurrent handshakes to one host get the same certificate
+	const n = 16
+	serials := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			leaf, err := ca.IssueFor("same.example.test")
+			if err != nil {
+				t.Errorf("issue: %v", err)
+				return
+			}
+			serials[i] = leaf.Leaf.SerialNumber.String()
+		}(i)
+	}
+	wg.Wait()
+	for _, s := range serials {
+		if s != serials[0] {
+			t.Fatalf("concurrent issuance produced different certificates: %v", serials)
+		}
+	}
+
+	// leaf keys come from a small reusable pool
+	keys := map[any]bool{}
+	for i := 0; i < 12; i++ {
+		leaf, err := ca.IssueFor("host" + strconv.Itoa(i) + ".example.test")
+		if err != nil {
+			t.Fatalf("issue: %v", err)
+		}
+		keys[leaf.PrivateKey] = true
+	}
+	if len(keys) > 4 {
+		t.Fatalf("expected leaf keys to be reused, got %d distinct keys", len(keys))
+	}
+}
@@ -0,0 +1,202 @@
+package integration
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+// startMITMApp starts the app with an in-memory dev CA intercepting every CONNECT and returns a
+// client trusting that CA, proxied through the app.
+func startMITMApp(t *testing.T, cfg config.Config, h2 bool) (*httptest.Server, *http.Client) {
+	t.Helper()
+	certPEM, keyPEM, err := httpapi.GenerateDevCA("test CA", 1)
+	if err != nil {
+		t.Fatalf("generate CA: %v", err)
+	}
+	return startMITMAppWithCA(t, cfg, certPEM, keyPEM, h2)
+}
+
+func startMITMAppWithCA(t *testing.T, cfg config.Config, certPEM, keyPEM []byte, h2 bool) (*httptest.Server, *http.Client) {
+	t.Helper()
+	ca, err := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("load CA: %v", err)
+	}
+	app, deps := startHTTPAppWithConfig(t, cfg)
+	deps.MITM = &httpapi.MITM{CA: ca}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+	proxyURL, _ := url.Parse(app.URL)
+	tr := &http.Transport{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: h2}
+	if !h2 {
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	t.Cleanup(tr.CloseIdleConnections)
+	return app, &http.Client{Transport: tr, Timeout: 10 * time.Second}
+}
+
+type mitmTx struct {
+	URL            string `json:"url"`
+	Status         int    `json:"status"`
+	Protocol       string `json:"protocol"`
+	ClientProtocol string `json:"clientProtocol"`
+	StreamID       uint32 `json:"streamId"`
+}
+
+// mitmTxs returns the transactions of all intercepted exchanges; each exchange must be its own
+// session and all of them must belong to the same tunnel.
+func mitmTxs(t *testing.T, app *httptest.Server) []mitmTx {
+	t.Helper()
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=50")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID       string `json:"id"`
+			Kind     string `json:"kind"`
+			Via      string `json:"via"`
+			TunnelID string `json:"tunnelId"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	var out []mitmTx
+	for _, s := range list.Items {
+		if s.Via != "mitm" || s.Kind != "http" || s.TunnelID == "" || s.TunnelID != list.Items[0].TunnelID {
+			t.Fatalf("unexpected session: %+v", s)
+		}
+		rh, err := app.Client().Get(app.URL + "/api/sessions/" + s.ID + "/http")
+		if err != nil {
+			t.Fatalf("http txs: %v", err)
+		}
+		var txs struct {
+			Items []mitmTx `json:"items"`
+		}
+		_ = json.NewDecoder(rh.Body).Decode(&txs)
+		rh.Body.Close()
+		if len(txs.Items) != 1 {
+			t.Fatalf("session %s: expected one transaction, got %d", s.ID, len(txs.Items))
+		}
+		out = append(out, txs.Items[0])
+	}
+	return out
+}
+
+func TestMITM_HTTP2ConcurrentStreams(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// keep streams in flight together
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.Proto + " " + r.URL.Path))
+	}))
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	app, client := startMITMApp(t, config.Config{InsecureTLS: true}, true)
+	defer app.Close()
+
+	// warm up the tunnel so all requests share one h2 connection
+	resp, err := client.Get(upstream.URL + "/warmup")
+	if err != nil {
+		t.Fatalf("warmup: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("client was downgraded to %s", resp.Proto)
+	}
+
+	const n = 6
+	var wg sync.WaitGroup
+	errs := make(chan string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := "/item/" + strconv.Itoa(i)
+			resp, err := client.Get(upstream.URL + p)
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(b) != "HTTP/2.0 "+p {
+				errs <- "unexpected body " + string(b) + " for " + p
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Fatal(e)
+	}
+	client.CloseIdleConnections()
+
+	txs := mitmTxs(t, app)
+	if len(txs) != n+1 {
+		t.Fatalf("expected %d transactions, got %d", n+1, len(txs))
+	}
+	seen := map[uint32]string{}
+	for _, tx := range txs {
+		if tx.Status != http.StatusOK || tx.Protocol != "h2" || tx.ClientProtocol != "h2" {
+			t.Fatalf("unexpected tx: %+v", tx)
+		}
+		if tx.StreamID == 0 || tx.StreamID%2 != 1 {
+			t.Fatalf("expected odd client stream id, got %+v", tx)
+		}
+		if prev, dup := seen[tx.StreamID]; dup {
+			t.Fatalf("stream %d recorded twice (%s, %s)", tx.StreamID, prev, tx.URL)
+		}
+		seen[tx.StreamID] = tx.URL
+	}
+}
+
+func TestMITM_HTTP1ClientKeepsWorking(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	app, client := startMITMApp(t, config.Config{InsecureTLS: true}, false)
+	defer app.Close()
+
+	for _, p := range []string{"/a", "/b"} {
+		resp, err := client.Get(upstream.URL + p)
+		if err != nil {
+			t.Fatalf("get %s: %v", p, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.ProtoMajor != 1 || string(b) != "ok "+p {
+			t.Fatalf("unexpected response %s %q", resp.Proto, b)
+		}
+	}
+	client.CloseIdleConnections()
+
+	txs := mitmTxs(t, app)
+	if len(txs) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(txs))
+	}
+	for _, tx := range txs {
+		if tx.ClientProtocol != "http/1.1" || tx.StreamID != 0 || tx.Status != http.StatusOK {
+			t.Fatalf("unexpected tx: %+v", tx)
+		}
+	}
+}
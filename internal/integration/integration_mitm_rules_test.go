@@ -0,0 +1,180 @@
+package integration
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"network-debugger/internal/domain"
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+// proxiedClient returns a client going through app; roots nil means "trust nothing but skip verify".
+func proxiedClient(t *testing.T, app *httptest.Server, roots *x509.CertPool) *http.Client {
+	t.Helper()
+	proxyURL, _ := url.Parse(app.URL)
+	tlsCfg := &tls.Config{RootCAs: roots}
+	if roots == nil {
+		tlsCfg = &tls.Config{InsecureSkipVerify: true}
+	}
+	tr := &http.Transport{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: tlsCfg, DisableKeepAlives: true}
+	t.Cleanup(tr.CloseIdleConnections)
+	return &http.Client{Transport: tr, Timeout: 5 * time.Second}
+}
+
+// lastSession returns the newest session of kind (waiting for it to close).
+func lastSession(t *testing.T, app *httptest.Server, kind string) domain.Session {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=50")
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		var list struct {
+			Items []domain.Session `json:"items"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&list)
+		r.Body.Close()
+		var last *domain.Session
+		for i := range list.Items {
+			s := list.Items[i]
+			if s.Kind == kind && (last == nil || s.StartedAt.After(last.StartedAt)) {
+				last = &s
+			}
+		}
+		if last != nil && last.ClosedAt != nil {
+			return *last
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no closed %s session: %+v", kind, list.Items)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func apiJSON(t *testing.T, app *httptest.Server, method, path, body string, out any) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, app.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		_ = json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+type interceptRules struct {
+	Items []httpapi.InterceptRule `json:"items"`
+}
+
+func TestMITM_InterceptRulesAtRuntime(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	_, portStr, _ := strings.Cut(strings.TrimPrefix(upstream.URL, "https://"), ":")
+
+	app, _ := startMITMApp(t, config.Config{InsecureTLS: true}, false)
+	defer app.Close()
+	client := proxiedClient(t, app, nil)
+	get := func() {
+		t.Helper()
+		resp, err := client.Get(upstream.URL + "/")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	if code := apiJSON(t, app, http.MethodPost, "/_api/v1/mitm/rules", `{"action":"passthrough","hostRegex":"("}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid regex: expected 400, got %d", code)
+	}
+	var rules interceptRules
+	apiJSON(t, app, http.MethodPost, "/_api/v1/mitm/rules", `{"action":"passthrough","hostRegex":"^127\\.0\\.0\\.\\d+$","port":`+portStr+`}`, &rules)
+	if len(rules.Items) != 1 || rules.Items[0].ID == "" {
+		t.Fatalf("rule not added: %+v", rules)
+	}
+	ruleID := rules.Items[0].ID
+
+	get()
+	s := lastSession(t, app, "tunnel")
+	if s.Tunnel == nil || s.Tunnel.MITMSkipped != "denied" || s.Tunnel.MITMRule != ruleID {
+		t.Fatalf("passthrough rule not applied: %+v", s.Tunnel)
+	}
+
+	// the rule now only applies to another client network: the tunnel is intercepted again
+	apiJSON(t, app, http.MethodPut, "/_api/v1/mitm/rules?id="+ruleID, `{"action":"passthrough","host":"127.0.0.*","client":"10.0.0.0/8"}`, &rules)
+	if len(rules.Items) != 1 || rules.Items[0].Client != "10.0.0.0/8" {
+		t.Fatalf("rule not updated: %+v", rules)
+	}
+	get()
+	if s := lastSession(t, app, "http"); s.Via != "mitm" {
+		t.Fatalf("expected an intercepted exchange, got %+v", s)
+	}
+
+	if code := apiJSON(t, app, http.MethodDelete, "/_api/v1/mitm/rules?id="+ruleID, "", &rules); code != http.StatusOK || len(rules.Items) != 0 {
+		t.Fatalf("delete: %d %+v", code, rules)
+	}
+	if code := apiJSON(t, app, http.MethodDelete, "/_api/v1/mitm/rules?id="+ruleID, "", nil); code != http.StatusNotFound {
+		t.Fatalf("second delete: expected 404, got %d", code)
+	}
+}
+
+func TestMITM_AutoPassthroughForPinnedClients(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	app, _ := startMITMApp(t, config.Config{InsecureTLS: true, MITMAutoPassthrough: true}, false)
+	defer app.Close()
+
+	// a client trusting only the real upstream refuses our leaf, like a pinned app
+	roots := x509.NewCertPool()
+	roots.AddCert(upstream.Certificate())
+	pinned := proxiedClient(t, app, roots)
+	if _, err := pinned.Get(upstream.URL + "/"); err == nil {
+		t.Fatalf("expected the pinned client to refuse the MITM certificate")
+	}
+	failed := lastSession(t, app, "tunnel")
+	if failed.Tunnel == nil || !failed.Tunnel.PassthroughLearned || failed.Error == nil || failed.Via != "mitm" {
+		t.Fatalf("refused handshake not recorded: %+v %+v", failed, failed.Tunnel)
+	}
+	var learned struct {
+		Items []httpapi.LearnedPassthrough `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/_api/v1/mitm/passthrough", "", &learned)
+	if len(learned.Items) != 1 || learned.Items[0].Host != "127.0.0.1" {
+		t.Fatalf("host not learned: %+v", learned)
+	}
+
+	// the next connection is tunneled and reaches the real server
+	resp, err := pinned.Get(upstream.URL + "/")
+	if err != nil {
+		t.Fatalf("pinned client through passthrough: %v", err)
+	}
+	resp.Body.Close()
+	if s := lastSession(t, app, "tunnel"); s.Tunnel == nil || s.Tunnel.MITMSkipped != "pinned" {
+		t.Fatalf("expected a pinned passthrough tunnel, got %+v", s.Tunnel)
+	}
+
+	apiJSON(t, app, http.MethodDelete, "/_api/v1/mitm/passthrough?host=127.0.0.1", "", &learned)
+	if len(learned.Items) != 0 {
+		t.Fatalf("host not forgotten: %+v", learned)
+	}
+}
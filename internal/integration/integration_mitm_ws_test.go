@@ -0,0 +1,154 @@
+package integration
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+func TestMITM_WebSocketFramesAndSocketIOEvents(t *testing.T) {
+	t.Parallel()
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			mt, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(mt, data); err != nil {
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	certPEM, keyPEM, err := httpapi.GenerateDevCA("test CA", 1)
+	if err != nil {
+		t.Fatalf("generate CA: %v", err)
+	}
+	ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	app, deps := startHTTPAppWithConfig(t, config.Config{InsecureTLS: true})
+	defer app.Close()
+	deps.MITM = &httpapi.MITM{CA: ca}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+	proxyURL, _ := url.Parse(app.URL)
+	dialer := websocket.Dialer{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: &tls.Config{RootCAs: roots}, EnableCompression: true, HandshakeTimeout: 5 * time.Second}
+	wsURL := "wss" + strings.TrimPrefix(upstream.URL, "https") + "/socket.io/?EIO=4&transport=websocket"
+	conn, resp, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial through MITM: %v", err)
+	}
+	if !strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+		t.Fatalf("compression was not negotiated end to end: %q", resp.Header.Get("Sec-WebSocket-Extensions"))
+	}
+	msg := `42["chat",{"text":"` + strings.Repeat("hi ", 50) + `"}]`
+	for i := 0; i < 2; i++ {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_, echo, err := conn.ReadMessage()
+		if err != nil || string(echo) != msg {
+			t.Fatalf("echo: %v %q", err, echo)
+		}
+	}
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))
+	_ = conn.Close()
+
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=10")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID     string `json:"id"`
+			Kind   string `json:"kind"`
+			Target string `json:"target"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	wsID := ""
+	for _, s := range list.Items {
+		if s.Kind == "ws" {
+			wsID = s.ID
+			if !strings.HasPrefix(s.Target, "wss://") || !strings.Contains(s.Target, "/socket.io/") {
+				t.Fatalf("unexpected ws target %q", s.Target)
+			}
+		}
+	}
+	if wsID == "" {
+		t.Fatalf("no ws session recorded: %+v", list.Items)
+	}
+
+	type frameView struct {
+		Direction string `json:"direction"`
+		Opcode    string `json:"opcode"`
+		Preview   string `json:"preview"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	var frames []frameView
+	for {
+		rf, err := app.Client().Get(app.URL + "/api/sessions/" + wsID + "/frames")
+		if err != nil {
+			t.Fatalf("frames: %v", err)
+		}
+		var out struct {
+			Items []frameView `json:"items"`
+		}
+		_ = json.NewDecoder(rf.Body).Decode(&out)
+		rf.Body.Close()
+		frames = out.Items
+		text := 0
+		for _, f := range frames {
+			if f.Opcode == "text" && strings.Contains(f.Preview, "chat") {
+				text++
+			}
+		}
+		if text == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 4 decoded text frames, got %+v", frames)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	re, err := app.Client().Get(app.URL + "/api/sessions/" + wsID + "/events")
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	var evs struct {
+		Items []struct {
+			Event string `json:"event"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(re.Body).Decode(&evs)
+	re.Body.Close()
+	chat := 0
+	for _, e := range evs.Items {
+		if e.Event == "chat" {
+			chat++
+		}
+	}
+	if chat != 4 {
+		t.Fatalf("expected 4 socket.io chat events, got %+v", evs.Items)
+	}
+}
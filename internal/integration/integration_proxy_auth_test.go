@@ -0,0 +1,176 @@
+package integration
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/proxy"
+
+	"network-debugger/internal/domain"
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+// userSessions lists the sessions attributed to user via the ?user= filter.
+func userSessions(t *testing.T, app *httptest.Server, user string) []domain.Session {
+	t.Helper()
+	var list struct {
+		Items []domain.Session `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/_api/v1/sessions?limit=50&user="+url.QueryEscape(user), "", &list)
+	return list.Items
+}
+
+func TestProxyAuth_RequiredAndAttributed(t *testing.T) {
+	t.Parallel()
+	var sawProxyAuth atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			sawProxyAuth.Store(true)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer tlsUpstream.Close()
+
+	app, deps := startHTTPAppWithConfig(t, config.Config{InsecureTLS: true, ProxyUsers: "alice:a1,bob:b2"})
+	defer app.Close()
+	certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+	ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	deps.MITM = &httpapi.MITM{CA: ca}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	client := func(userinfo *url.Userinfo) *http.Client {
+		proxyURL, _ := url.Parse(app.URL)
+		proxyURL.User = userinfo
+		tr := &http.Transport{Proxy: http.ProxyURL(proxyURL), TLSClientConfig: &tls.Config{RootCAs: roots}}
+		t.Cleanup(tr.CloseIdleConnections)
+		return &http.Client{Transport: tr, Timeout: 5 * time.Second}
+	}
+
+	for _, ui := range []*url.Userinfo{nil, url.UserPassword("alice", "wrong")} {
+		resp, err := client(ui).Get(upstream.URL + "/x")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusProxyAuthRequired || resp.Header.Get("Proxy-Authenticate") == "" {
+			t.Fatalf("expected 407 with a challenge, got %d %v", resp.StatusCode, resp.Header)
+		}
+	}
+	if _, err := client(nil).Get(tlsUpstream.URL); err == nil {
+		t.Fatalf("expected CONNECT without credentials to fail")
+	}
+
+	alice, bob := client(url.UserPassword("alice", "a1")), client(url.UserPassword("bob", "b2"))
+	for _, c := range []*http.Client{alice, bob} {
+		resp, err := c.Get(upstream.URL + "/plain")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+	}
+	resp, err := alice.Get(tlsUpstream.URL + "/mitm")
+	if err != nil {
+		t.Fatalf("mitm get: %v", err)
+	}
+	resp.Body.Close()
+
+	// /httpproxy takes the same header
+	req, _ := http.NewRequest(http.MethodGet, app.URL+"/httpproxy/rev?_target="+url.QueryEscape(upstream.URL), nil)
+	if resp, err := app.Client().Do(req); err != nil || resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Fatalf("expected 407 for /httpproxy: %v %v", err, resp)
+	}
+	req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("bob:b2")))
+	resp, err = app.Client().Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("/httpproxy with credentials: %v %v", err, resp)
+	}
+	resp.Body.Close()
+
+	aliceTargets := map[string]bool{}
+	for _, s := range userSessions(t, app, "alice") {
+		if s.User != "alice" {
+			t.Fatalf("filter returned another user's session: %+v", s)
+		}
+		aliceTargets[s.Target] = true
+	}
+	if len(aliceTargets) != 2 || !aliceTargets[upstream.URL+"/plain"] || !aliceTargets[tlsUpstream.URL+"/mitm"] {
+		t.Fatalf("unexpected alice sessions: %v", aliceTargets)
+	}
+	if n := len(userSessions(t, app, "bob")); n != 2 {
+		t.Fatalf("expected 2 bob sessions, got %d", n)
+	}
+	if sawProxyAuth.Load() {
+		t.Fatalf("Proxy-Authorization leaked upstream")
+	}
+}
+
+func TestProxyAuth_SOCKSAcceptsProxyUsers(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	app, deps := startHTTPAppWithConfig(t, config.Config{ProxyUsers: "carol:c3"})
+	defer app.Close()
+	addr := startSOCKS(t, deps)
+
+	if _, err := socksClient(t, addr, nil, nil).Get(upstream.URL); err == nil {
+		t.Fatalf("expected SOCKS without credentials to fail")
+	}
+	c := socksClient(t, addr, &proxy.Auth{User: "carol", Password: "c3"}, nil)
+	resp, err := c.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	c.Transport.(*http.Transport).CloseIdleConnections()
+	if s := waitTunnelSession(t, app); s.User != "carol" {
+		t.Fatalf("tunnel not attributed: %+v", s)
+	}
+}
+
+func TestProxyAuth_WebSocketProxies(t *testing.T) {
+	t.Parallel()
+	echo, echoWS := startEchoWSServer(t)
+	defer echo.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{ProxyUsers: "dave:d4"})
+	defer app.Close()
+
+	for _, path := range []string{"/wsproxy", "/proxy"} {
+		target := wsURLFromHTTP(app.URL, path) + "?_target=" + url.QueryEscape(echoWS)
+		_, resp, err := websocket.DefaultDialer.Dial(target, nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusProxyAuthRequired {
+			t.Fatalf("%s without credentials: err=%v resp=%v", path, err, resp)
+		}
+		hdr := http.Header{}
+		hdr.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("dave:d4")))
+		c, _, err := websocket.DefaultDialer.Dial(target, hdr)
+		if err != nil {
+			t.Fatalf("%s with credentials: %v", path, err)
+		}
+		c.Close()
+	}
+	sessions := userSessions(t, app, "dave")
+	if len(sessions) != 2 || sessions[0].Kind != "ws" || sessions[1].Kind != "ws" {
+		t.Fatalf("ws sessions not attributed to dave: %+v", sessions)
+	}
+}
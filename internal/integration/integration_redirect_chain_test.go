@@ -0,0 +1,80 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+func TestRedirectChain_ClientFollowedHopsAreLinked(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.Redirect(w, r, "/authorize?state=1", http.StatusFound)
+		case "/authorize":
+			http.Redirect(w, r, "/callback", http.StatusSeeOther)
+		default:
+			_, _ = w.Write([]byte("done"))
+		}
+	}))
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	// plain-http forward proxy: the client follows the redirects itself
+	appURL, _ := url.Parse(app.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(appURL)}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(upstream.URL + "/login")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "done" {
+		t.Fatalf("unexpected final body %q", b)
+	}
+
+	type sessView struct {
+		ID           string `json:"id"`
+		Target       string `json:"target"`
+		ChainID      string `json:"chainId"`
+		RedirectFrom string `json:"redirectFrom"`
+	}
+	list := func(query string) []sessView {
+		r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=50" + query)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		defer r.Body.Close()
+		var out struct {
+			Items []sessView `json:"items"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&out)
+		return out.Items
+	}
+	all := list("")
+	if len(all) != 3 {
+		t.Fatalf("expected 3 hop sessions, got %+v", all)
+	}
+	byTarget := map[string]sessView{}
+	for _, s := range all {
+		byTarget[s.Target] = s
+	}
+	first, second, third := byTarget[upstream.URL+"/login"], byTarget[upstream.URL+"/authorize?state=1"], byTarget[upstream.URL+"/callback"]
+	if first.ChainID != first.ID || second.ChainID != first.ID || third.ChainID != first.ID {
+		t.Fatalf("hops not linked into one chain: %+v", all)
+	}
+	if second.RedirectFrom != first.ID || third.RedirectFrom != second.ID {
+		t.Fatalf("unexpected redirectFrom links: %+v", all)
+	}
+	if chain := list("&chainId=" + first.ID); len(chain) != 3 {
+		t.Fatalf("chainId filter returned %d sessions", len(chain))
+	}
+}
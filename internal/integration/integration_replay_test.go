@@ -0,0 +1,132 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"network-debugger/internal/adapters/storage/memory"
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+	obs "network-debugger/internal/infrastructure/observability"
+	"network-debugger/internal/usecase"
+)
+
+func startHTTPAppWithConfig(t *testing.T, cfg config.Config) (*httptest.Server, *httpapi.Deps) {
+	t.Helper()
+	if cfg.CORSAllowOrigin == "" {
+		cfg.CORSAllowOrigin = "*"
+	}
+	logger := obs.NewLogger("error")
+	metrics := obs.NewMetrics()
+	store := memory.NewStore(500, 10000, 2*time.Hour)
+	svc := usecase.NewSessionService(store, store, store)
+	deps := &httpapi.Deps{Cfg: cfg, Logger: logger, Metrics: metrics, Svc: svc, Monitor: httpapi.NewMonitorHub()}
+	srv := httptest.NewServer(httpapi.NewRouterWithDeps(deps))
+	return srv, deps
+}
+
+func TestReplay_ReissuesCapturedRequestWithOverrides(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var bodies []string
+	var markers []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		markers = append(markers, r.Header.Get("X-Marker"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	app, _ := startHTTPAppWithConfig(t, config.Config{CaptureBodies: true, BodyMaxBytes: 1 << 20, BodySpoolDir: t.TempDir()})
+	defer app.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, app.URL+"/httpproxy/items?_target="+url.QueryEscape(upstream.URL), strings.NewReader(`{"name":"a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Marker", "orig")
+	req.Header.Set("X-Debugger-Client", "qa-phone")
+	resp, err := app.Client().Do(req)
+	if err != nil {
+		t.Fatalf("proxy post: %v", err)
+	}
+	resp.Body.Close()
+
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=10")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID       string `json:"id"`
+			ClientID string `json:"clientId"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	if len(list.Items) != 1 {
+		t.Fatalf("expected one session, got %d", len(list.Items))
+	}
+	origID, origClient := list.Items[0].ID, list.Items[0].ClientID
+
+	in, _ := json.Marshal(map[string]any{"count": 2, "headers": map[string]string{"X-Marker": "replayed"}})
+	rr, err := app.Client().Post(app.URL+"/_api/v1/sessions/"+origID+"/replay", "application/json", bytes.NewReader(in))
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	defer rr.Body.Close()
+	if rr.StatusCode != http.StatusOK {
+		t.Fatalf("replay status: %d", rr.StatusCode)
+	}
+	var out struct {
+		ReplayOf string `json:"replayOf"`
+		Runs     []struct {
+			SessionID string `json:"sessionId"`
+			Status    int    `json:"status"`
+		} `json:"runs"`
+		Summary struct {
+			Count     int `json:"count"`
+			Succeeded int `json:"succeeded"`
+		} `json:"summary"`
+	}
+	_ = json.NewDecoder(rr.Body).Decode(&out)
+	if out.ReplayOf != origID || len(out.Runs) != 2 || out.Summary.Succeeded != 2 {
+		t.Fatalf("unexpected replay result: %+v", out)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 3 {
+		t.Fatalf("expected 3 upstream hits, got %d", len(bodies))
+	}
+	for i := 1; i < 3; i++ {
+		if bodies[i] != `{"name":"a"}` || markers[i] != "replayed" {
+			t.Fatalf("replay %d: body=%q marker=%q", i, bodies[i], markers[i])
+		}
+	}
+
+	rs, err := app.Client().Get(app.URL + "/_api/v1/sessions/" + out.Runs[0].SessionID)
+	if err != nil {
+		t.Fatalf("get replay session: %v", err)
+	}
+	defer rs.Body.Close()
+	var sess struct {
+		ReplayOf string `json:"replayOf"`
+		Kind     string `json:"kind"`
+		ClientID string `json:"clientId"`
+	}
+	_ = json.NewDecoder(rs.Body).Decode(&sess)
+	if sess.ReplayOf != origID || sess.Kind != "http" || origClient == "" || sess.ClientID != origClient {
+		t.Fatalf("replay session not linked: %+v", sess)
+	}
+}
@@ -0,0 +1,140 @@
+package integration
+
+import (
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+func TestProxyPAC_RoutesInterceptedDomains(t *testing.T) {
+	t.Parallel()
+	app, deps := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+	certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+	ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	deps.MITM = &httpapi.MITM{CA: ca, AllowSuffix: []string{"example.com"}, DenySuffix: []string{"bank.example.com"}}
+	// rule IDs are client-chosen on PUT and must not reach the script
+	apiJSON(t, app, http.MethodPut, "/_api/v1/mitm/rules", `{"items":[
+		{"id":"r1\nreturn \"PROXY evil:1\";","action":"passthrough","host":"*.cdn.example.com"},
+		{"action":"intercept","host":"other.test","client":"10.9.9.9"}]}`, nil)
+
+	resp, err := app.Client().Get(app.URL + "/proxy.pac")
+	if err != nil {
+		t.Fatalf("get pac: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	pac := string(b)
+	if resp.Header.Get("Content-Type") != "application/x-ns-proxy-autoconfig" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	proxyAddr := strings.TrimPrefix(app.URL, "http://")
+	for _, want := range []string{
+		`var proxy = "PROXY ` + proxyAddr + `";`,
+		`if (shExpMatch(host, "*.cdn.example.com")) return "DIRECT";`,
+		`if (host == "bank.example.com" || dnsDomainIs(host, "bank.example.com")) return "DIRECT";`,
+		`if (host == "example.com" || dnsDomainIs(host, "example.com")) return proxy;`,
+	} {
+		if !strings.Contains(pac, want) {
+			t.Fatalf("pac misses %q:\n%s", want, pac)
+		}
+	}
+	// rules for other clients are left out; unlisted hosts go direct
+	if strings.Contains(pac, "other.test") || strings.Contains(pac, "evil") || !strings.HasSuffix(pac, "  return \"DIRECT\";\n}\n") {
+		t.Fatalf("unexpected pac:\n%s", pac)
+	}
+	if strings.Index(pac, "*.cdn.example.com") > strings.Index(pac, "bank.example.com") {
+		t.Fatalf("rules must come before the domain lists:\n%s", pac)
+	}
+}
+
+func TestSetup_JSONAndQRCode(t *testing.T) {
+	t.Parallel()
+	app, _ := startHTTPAppWithConfig(t, config.Config{SOCKSAddr: ":1080"})
+	defer app.Close()
+	host := strings.TrimPrefix(app.URL, "http://")
+
+	var out struct {
+		Proxies []struct {
+			Interface string `json:"interface"`
+			Host      string `json:"host"`
+			Port      int    `json:"port"`
+			PACURL    string `json:"pacUrl"`
+		} `json:"proxies"`
+		PACURL    string `json:"pacUrl"`
+		CAURL     string `json:"caUrl"`
+		HasCA     bool   `json:"hasCA"`
+		SOCKSPort int    `json:"socksPort"`
+	}
+	if code := apiJSON(t, app, http.MethodGet, "/setup", "", &out); code != http.StatusOK {
+		t.Fatalf("setup: %d", code)
+	}
+	if out.PACURL != "http://"+host+"/proxy.pac" || out.HasCA || out.CAURL != "" || out.SOCKSPort != 1080 {
+		t.Fatalf("unexpected setup: %+v", out)
+	}
+	for _, p := range out.Proxies {
+		if p.Host == "" || p.Interface == "" || !strings.HasSuffix(p.PACURL, "/proxy.pac") || !strings.HasSuffix(app.URL, ":"+strconv.Itoa(p.Port)) {
+			t.Fatalf("unexpected proxy entry: %+v", p)
+		}
+	}
+
+	resp, err := app.Client().Get(app.URL + "/setup?format=png&size=200")
+	if err != nil {
+		t.Fatalf("get png: %v", err)
+	}
+	defer resp.Body.Close()
+	img, err := png.Decode(resp.Body)
+	if err != nil || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("not a png: %v %q", err, resp.Header.Get("Content-Type"))
+	}
+	if img.Bounds().Dx() != 200 {
+		t.Fatalf("unexpected size %v", img.Bounds())
+	}
+}
+
+func TestProxyPAC_FailsOpenAndHonorsClientSetting(t *testing.T) {
+	t.Parallel()
+	app, deps := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+	certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+	ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	deps.MITM = &httpapi.MITM{CA: ca, AllowSuffix: []string{"example.com"}}
+	apiJSON(t, app, http.MethodPut, "/_api/v1/mitm/rules", `{"items":[
+		{"action":"passthrough","hostRegex":"^skip\\."},
+		{"action":"passthrough","host":"static.example.com"},
+		{"action":"intercept","host":"api.test","port":8443}]}`, nil)
+	getPAC := func(device string) string {
+		req, _ := http.NewRequest(http.MethodGet, app.URL+"/proxy.pac", nil)
+		req.Header.Set("X-Debugger-Client", device)
+		resp, err := app.Client().Do(req)
+		if err != nil {
+			t.Fatalf("get pac: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	// the port rule cannot be expressed: hosts not decided before it go through the proxy
+	pac := getPAC("tablet")
+	if !strings.Contains(pac, `if (shExpMatch(host, "static.example.com")) return "DIRECT";`) || strings.Contains(pac, "skip") ||
+		!strings.HasSuffix(pac, "  return proxy; // port or hostRegex rule\n}\n") || strings.Contains(pac, "dnsDomainIs") {
+		t.Fatalf("pac does not fail open:\n%s", pac)
+	}
+
+	c := findClient(t, app, func(c httpapi.Client) bool { return c.Key == "tablet" })
+	apiJSON(t, app, http.MethodPut, "/_api/v1/clients?id="+c.ID, `{"settings":{"mitm":"passthrough"}}`, nil)
+	if pac := getPAC("tablet"); strings.Contains(pac, "static.example.com") || !strings.HasSuffix(pac, "  return \"DIRECT\";\n}\n") {
+		t.Fatalf("client passthrough not honored:\n%s", pac)
+	}
+	apiJSON(t, app, http.MethodPut, "/_api/v1/clients?id="+c.ID, `{"settings":{"mitm":"intercept"}}`, nil)
+	if pac := getPAC("tablet"); strings.Contains(pac, "static.example.com") || !strings.HasSuffix(pac, "  return proxy;\n}\n") {
+		t.Fatalf("client intercept not honored:\n%s", pac)
+	}
+}
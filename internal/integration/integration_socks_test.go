@@ -0,0 +1,230 @@
+package integration
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+// startSOCKS serves deps' SOCKS5 listener on a random port and returns its address.
+func startSOCKS(t *testing.T, deps *httpapi.Deps) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() { _ = deps.ServeSOCKS5(ln) }()
+	return ln.Addr().String()
+}
+
+// socksClient returns an HTTP client dialing through the SOCKS5 listener at addr.
+func socksClient(t *testing.T, addr string, auth *proxy.Auth, roots *x509.CertPool) *http.Client {
+	t.Helper()
+	dialer, err := proxy.SOCKS5("tcp", addr, auth, proxy.Direct)
+	if err != nil {
+		t.Fatalf("socks dialer: %v", err)
+	}
+	tr := &http.Transport{
+		DialContext:     dialer.(proxy.ContextDialer).DialContext,
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}
+	t.Cleanup(tr.CloseIdleConnections)
+	return &http.Client{Transport: tr, Timeout: 5 * time.Second}
+}
+
+func TestSOCKS5_TLSIntercepted(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret"))
+	}))
+	defer upstream.Close()
+
+	certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+	ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	app, deps := startHTTPAppWithConfig(t, config.Config{InsecureTLS: true, SOCKSUsername: "u", SOCKSPassword: "p"})
+	defer app.Close()
+	deps.MITM = &httpapi.MITM{CA: ca}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+	client := socksClient(t, startSOCKS(t, deps), &proxy.Auth{User: "u", Password: "p"}, roots)
+
+	resp, err := client.Get(upstream.URL + "/hidden?q=1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "secret" {
+		t.Fatalf("unexpected body %q", b)
+	}
+	txs := mitmTxs(t, app)
+	if len(txs) != 1 || !strings.HasSuffix(txs[0].URL, "/hidden?q=1") || txs[0].Status != 200 {
+		t.Fatalf("unexpected transactions: %+v", txs)
+	}
+}
+
+func TestSOCKS5_OpaqueTunnel(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("plain"))
+	}))
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		name string
+		mitm bool
+		want string
+	}{
+		{"disabled", false, "disabled"},
+		{"not_tls", true, "not_tls"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			app, deps := startHTTPAppWithConfig(t, config.Config{})
+			defer app.Close()
+			if tc.mitm {
+				certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+				ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+				deps.MITM = &httpapi.MITM{CA: ca}
+			}
+			client := socksClient(t, startSOCKS(t, deps), nil, nil)
+			resp, err := client.Get(upstream.URL + "/x")
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			client.Transport.(*http.Transport).CloseIdleConnections()
+			if string(b) != "plain" {
+				t.Fatalf("unexpected body %q", b)
+			}
+
+			s := waitTunnelSession(t, app)
+			if s.Kind != "tunnel" || s.Via != "socks" || s.Tunnel == nil || s.Error != nil {
+				t.Fatalf("unexpected session: %+v", s)
+			}
+			if s.Tunnel.TLS || s.Tunnel.BytesUp == 0 || s.Tunnel.BytesDown == 0 || s.Tunnel.MITMSkipped != tc.want {
+				t.Fatalf("unexpected tunnel info: %+v", s.Tunnel)
+			}
+		})
+	}
+}
+
+func TestSOCKS5_PlainHTTPOnPort80(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:80")
+	if err != nil {
+		t.Skipf("cannot listen on port 80: %v", err)
+	}
+	upstream := &httptest.Server{Listener: ln, Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello " + r.URL.Path))
+	})}}
+	upstream.Start()
+	defer upstream.Close()
+
+	app, deps := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+	client := socksClient(t, startSOCKS(t, deps), nil, nil)
+	for _, p := range []string{"/a", "/b"} {
+		resp, err := client.Get("http://127.0.0.1" + p)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != "hello "+p {
+			t.Fatalf("unexpected body %q", b)
+		}
+	}
+	s := lastSession(t, app, "http")
+	if s.Via != "socks" || s.TunnelID == "" {
+		t.Fatalf("unexpected session: %+v", s)
+	}
+}
+
+func TestSOCKS5_RejectsBadCredentials(t *testing.T) {
+	t.Parallel()
+	app, deps := startHTTPAppWithConfig(t, config.Config{SOCKSUsername: "u", SOCKSPassword: "p"})
+	defer app.Close()
+	addr := startSOCKS(t, deps)
+	for _, auth := range []*proxy.Auth{nil, {User: "u", Password: "wrong"}} {
+		dialer, _ := proxy.SOCKS5("tcp", addr, auth, proxy.Direct)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		c, err := dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", "127.0.0.1:9")
+		cancel()
+		if err == nil {
+			c.Close()
+			t.Fatalf("expected auth failure for %+v", auth)
+		}
+	}
+}
+
+func TestSOCKS5_DecidesBySNI(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret"))
+	}))
+	defer upstream.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(upstream.URL, "https://"))
+
+	for _, tc := range []struct {
+		name string
+		deny []string
+	}{
+		{"intercepted", nil},
+		{"denied", []string{"example.test"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+			ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+			app, deps := startHTTPAppWithConfig(t, config.Config{InsecureTLS: true})
+			defer app.Close()
+			deps.MITM = &httpapi.MITM{CA: ca, DenySuffix: tc.deny}
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM(certPEM)
+			if tc.deny != nil {
+				roots = nil
+			}
+			// the client asks SOCKS for the IP and names the host only in the SNI
+			client := socksClient(t, startSOCKS(t, deps), nil, roots)
+			tr := client.Transport.(*http.Transport)
+			tr.TLSClientConfig.ServerName = "api.example.test"
+			tr.TLSClientConfig.InsecureSkipVerify = tc.deny != nil
+			resp, err := client.Get(upstream.URL + "/x")
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			tr.CloseIdleConnections()
+			if string(b) != "secret" {
+				t.Fatalf("unexpected body %q", b)
+			}
+
+			if tc.deny == nil {
+				txs := mitmTxs(t, app)
+				if len(txs) != 1 || txs[0].URL != "https://api.example.test:"+port+"/x" {
+					t.Fatalf("unexpected transactions: %+v", txs)
+				}
+				return
+			}
+			s := waitTunnelSession(t, app)
+			if s.Target != "connect://api.example.test:"+port || s.Tunnel == nil || s.Tunnel.MITMSkipped != "denied" {
+				t.Fatalf("unexpected session: %+v", s)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package integration
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+func TestSSEStream_FlushedAndParsedIntoEvents(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = fmt.Fprint(w, ": hello\n\nid: 1\nevent: tick\ndata: first\ndata: line\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		// the trailing event lacks its blank line and must be discarded
+		_, _ = fmt.Fprint(w, "data: {\"n\":2}\r\n\r\ndata: unterminated\n")
+	}))
+	defer upstream.Close()
+	defer close(release)
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	resp, err := app.Client().Get(app.URL + "/httpproxy/?_target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	// the first event must reach the client while upstream keeps the stream open
+	lines := make(chan string, 16)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+	timeout := time.After(2 * time.Second)
+	for got := false; !got; {
+		select {
+		case l := <-lines:
+			got = l == "data: line"
+		case <-timeout:
+			t.Fatalf("first SSE event was not flushed to the client")
+		}
+	}
+
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=1")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	if len(list.Items) != 1 {
+		t.Fatalf("expected one session, got %d", len(list.Items))
+	}
+	type evView struct {
+		Namespace   string `json:"namespace"`
+		Event       string `json:"event"`
+		ArgsPreview string `json:"argsPreview"`
+		SSEID       string `json:"sseId"`
+	}
+	events := func() []evView {
+		re, err := app.Client().Get(app.URL + "/api/sessions/" + list.Items[0].ID + "/events")
+		if err != nil {
+			t.Fatalf("events: %v", err)
+		}
+		defer re.Body.Close()
+		var out struct {
+			Items []evView `json:"items"`
+		}
+		_ = json.NewDecoder(re.Body).Decode(&out)
+		return out.Items
+	}
+	evs := events()
+	if len(evs) != 1 || evs[0].Namespace != "sse" || evs[0].Event != "tick" || evs[0].SSEID != "1" || evs[0].ArgsPreview != "first\nline" {
+		t.Fatalf("unexpected events while streaming: %+v", evs)
+	}
+
+	release <- struct{}{}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		evs = events()
+		if len(evs) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("second event not recorded: %+v", evs)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if evs[1].Event != "message" || evs[1].SSEID != "1" || !strings.Contains(evs[1].ArgsPreview, `"n":2`) {
+		t.Fatalf("unexpected second event: %+v", evs[1])
+	}
+	for range lines {
+	}
+	if evs = events(); len(evs) != 2 {
+		t.Fatalf("unterminated trailing event recorded: %+v", evs)
+	}
+}
+
+func TestChunkedResponse_OutlivesWriteWindow(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// no Content-Length and not a streaming media type: relayed chunked
+		w.Header().Set("Content-Type", "text/plain")
+		for i := 0; i < 8; i++ {
+			_, _ = fmt.Fprintf(w, "chunk %d\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{ProxyWriteWindowMs: 200})
+	defer app.Close()
+
+	resp, err := app.Client().Get(app.URL + "/httpproxy/?_target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil || strings.Count(string(b), "chunk") != 8 {
+		t.Fatalf("chunked body cut by the write window: %v %q", err, b)
+	}
+}
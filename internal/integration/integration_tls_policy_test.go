@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+func TestUpstreamTLS_TrustBundleAndPerHostPolicy(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("secure")) }))
+	upstream.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	upstream.StartTLS()
+	defer upstream.Close()
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0o600); err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	get := func(cfg config.Config) (int, string) {
+		app, _ := startHTTPAppWithConfig(t, cfg)
+		defer app.Close()
+		resp, err := app.Client().Get(app.URL + "/httpproxy/?_target=" + url.QueryEscape(upstream.URL))
+		if err != nil {
+			t.Fatalf("proxy: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=1")
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		var list struct {
+			Items []struct {
+				ID string `json:"id"`
+			} `json:"items"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&list)
+		r.Body.Close()
+		rf, err := app.Client().Get(app.URL + "/api/sessions/" + list.Items[0].ID + "/frames")
+		if err != nil {
+			t.Fatalf("frames: %v", err)
+		}
+		var frames struct {
+			Items []struct {
+				Preview string `json:"preview"`
+			} `json:"items"`
+		}
+		_ = json.NewDecoder(rf.Body).Decode(&frames)
+		rf.Body.Close()
+		for _, f := range frames.Items {
+			if strings.Contains(f.Preview, `"type":"tls_error"`) {
+				return resp.StatusCode, f.Preview
+			}
+		}
+		return resp.StatusCode, ""
+	}
+
+	// untrusted self-signed upstream: failure recorded with the presented chain
+	status, preview := get(config.Config{})
+	if status != http.StatusBadGateway || preview == "" {
+		t.Fatalf("expected recorded verification failure, got status=%d preview=%q", status, preview)
+	}
+	var tlsErr struct {
+		Host  string `json:"host"`
+		Chain []struct {
+			PEM string `json:"pem"`
+		} `json:"chain"`
+	}
+	_ = json.Unmarshal([]byte(preview), &tlsErr)
+	if tlsErr.Host != "127.0.0.1" || len(tlsErr.Chain) == 0 || !strings.Contains(tlsErr.Chain[0].PEM, "BEGIN CERTIFICATE") {
+		t.Fatalf("unexpected tls_error preview: %s", preview)
+	}
+
+	// trusted via bundle
+	if status, _ := get(config.Config{UpstreamCABundle: bundle}); status != http.StatusOK {
+		t.Fatalf("bundle: expected 200, got %d", status)
+	}
+	// verification skipped for this host only
+	if status, _ := get(config.Config{UpstreamTLSPolicies: "127.0.0.1=insecure"}); status != http.StatusOK {
+		t.Fatalf("insecure policy: expected 200, got %d", status)
+	}
+	// upstream caps at TLS 1.2, policy demands 1.3
+	if status, _ := get(config.Config{UpstreamCABundle: bundle, UpstreamTLSPolicies: "127.0.0.1=minVersion:1.3"}); status != http.StatusBadGateway {
+		t.Fatalf("minVersion policy: expected 502, got %d", status)
+	}
+}
@@ -0,0 +1,156 @@
+package integration
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+// startTransparent serves deps' transparent TLS listener and returns a dial func that sends
+// every connection to it, as a DNS override pointing the app's host to the debugger would.
+func startTransparent(t *testing.T, deps *httpapi.Deps) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() { _ = deps.ServeTransparentTLS(ln) }()
+	return func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, ln.Addr().String())
+	}
+}
+
+func TestTransparentTLS_InterceptsBySNI(t *testing.T) {
+	t.Parallel()
+	upgrader := websocket.Upgrader{}
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			c, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			mt, data, err := c.ReadMessage()
+			if err == nil {
+				_ = c.WriteMessage(mt, data)
+			}
+			return
+		}
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(upstreamURL.Port())
+
+	certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+	ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+	cfg := config.Config{InsecureTLS: true, DNSOverrides: "api.example.test=127.0.0.1", TransparentUpstreamPort: port}
+	app, deps := startHTTPAppWithConfig(t, cfg)
+	defer app.Close()
+	deps.MITM = &httpapi.MITM{CA: ca}
+	dial := startTransparent(t, deps)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	for _, h2 := range []bool{true, false} {
+		tr := &http.Transport{DialContext: dial, TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: h2}
+		if !h2 {
+			tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+		resp, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get("https://api.example.test/x")
+		if err != nil {
+			t.Fatalf("get (h2=%v): %v", h2, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		tr.CloseIdleConnections()
+		// the client side keeps its own protocol; the upstream leg negotiates separately
+		wantMajor := 1
+		if h2 {
+			wantMajor = 2
+		}
+		if resp.ProtoMajor != wantMajor || string(b) != "api.example.test" {
+			t.Fatalf("unexpected response (h2=%v): %s %q", h2, resp.Proto, b)
+		}
+		s := lastSession(t, app, "http")
+		if s.Via != "transparent" || s.TunnelID == "" || s.Target != "https://api.example.test:"+upstreamURL.Port()+"/x" {
+			t.Fatalf("unexpected session: %+v", s)
+		}
+	}
+
+	wsDialer := websocket.Dialer{NetDialContext: dial, TLSClientConfig: &tls.Config{RootCAs: roots}, HandshakeTimeout: 5 * time.Second}
+	conn, _, err := wsDialer.Dial("wss://api.example.test/ws", nil)
+	if err != nil {
+		t.Fatalf("ws dial: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatalf("ws write: %v", err)
+	}
+	if _, echo, err := conn.ReadMessage(); err != nil || string(echo) != "ping" {
+		t.Fatalf("ws echo: %v %q", err, echo)
+	}
+	_ = conn.Close()
+	if s := lastSession(t, app, "ws"); s.Via != "transparent" {
+		t.Fatalf("unexpected ws session: %+v", s)
+	}
+}
+
+func TestTransparentTLS_PassthroughAndLoopGuard(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("opaque"))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(upstreamURL.Port())
+
+	// without a CA every connection is relayed to the resolved upstream as a tunnel
+	app, deps := startHTTPAppWithConfig(t, config.Config{DNSOverrides: "api.example.test=127.0.0.1", TransparentUpstreamPort: port})
+	defer app.Close()
+	tr := &http.Transport{DialContext: startTransparent(t, deps), TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	resp, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get("https://api.example.test/")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	tr.CloseIdleConnections()
+	if string(b) != "opaque" {
+		t.Fatalf("unexpected body %q", b)
+	}
+	s := waitTunnelSession(t, app)
+	if s.Via != "transparent" || s.Tunnel == nil || s.Tunnel.SNI != "api.example.test" || s.Tunnel.MITMSkipped != "disabled" || s.Tunnel.BytesDown == 0 {
+		t.Fatalf("unexpected tunnel session: %+v %+v", s, s.Tunnel)
+	}
+
+	// a resolver that still returns the listener itself must not make the debugger dial itself
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	loopPort := ln.Addr().(*net.TCPAddr).Port
+	_, loopDeps := startHTTPAppWithConfig(t, config.Config{DNSOverrides: "api.example.test=127.0.0.1", TransparentUpstreamPort: loopPort})
+	go func() { _ = loopDeps.ServeTransparentTLS(ln) }()
+	c, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: "api.example.test", InsecureSkipVerify: true})
+	if err == nil {
+		c.Close()
+		t.Fatalf("expected the looping connection to be dropped")
+	}
+}
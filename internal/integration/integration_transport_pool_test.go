@@ -0,0 +1,75 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+func TestTransportPool_ReusesUpstreamConnections(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) }))
+	defer upstream.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	type txView struct {
+		ConnReused bool   `json:"connReused"`
+		ConnID     string `json:"connId"`
+		Protocol   string `json:"protocol"`
+	}
+	var txs []txView
+	for i := 0; i < 4; i++ {
+		resp, err := app.Client().Get(app.URL + "/httpproxy/?_target=" + url.QueryEscape(upstream.URL))
+		if err != nil {
+			t.Fatalf("proxy: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=10")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var list struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&list)
+	r.Body.Close()
+	for _, it := range list.Items {
+		rt, err := app.Client().Get(app.URL + "/api/sessions/" + it.ID + "/http")
+		if err != nil {
+			t.Fatalf("http list: %v", err)
+		}
+		var out struct {
+			Items []txView `json:"items"`
+		}
+		_ = json.NewDecoder(rt.Body).Decode(&out)
+		rt.Body.Close()
+		txs = append(txs, out.Items...)
+	}
+	if len(txs) != 4 {
+		t.Fatalf("expected 4 transactions, got %d", len(txs))
+	}
+	ids := map[string]bool{}
+	reused := 0
+	for _, tx := range txs {
+		if tx.ConnID == "" || tx.Protocol != "http/1.1" {
+			t.Fatalf("connection info missing: %+v", tx)
+		}
+		ids[tx.ConnID] = true
+		if tx.ConnReused {
+			reused++
+		}
+	}
+	if reused == 0 || len(ids) == len(txs) {
+		t.Fatalf("no upstream connection reuse observed: %+v", txs)
+	}
+}
@@ -0,0 +1,164 @@
+package integration
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"network-debugger/internal/domain"
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+// waitTunnelSession polls until the single tunnel session is closed and returns it.
+func waitTunnelSession(t *testing.T, app *httptest.Server) domain.Session {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		r, err := app.Client().Get(app.URL + "/_api/v1/sessions?limit=10")
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		var list struct {
+			Items []domain.Session `json:"items"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&list)
+		r.Body.Close()
+		if len(list.Items) == 1 && list.Items[0].ClosedAt != nil {
+			return list.Items[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tunnel session not closed: %+v", list.Items)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestConnectTunnel_RecordsClientHelloAndCounters(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("opaque"))
+	}))
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		name string
+		mitm *httpapi.MITM
+		want string
+	}{
+		{"disabled", nil, "disabled"},
+		{"no_ca", &httpapi.MITM{}, "no_ca"},
+		{"denied", nil, "denied"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			app, deps := startHTTPAppWithConfig(t, config.Config{})
+			defer app.Close()
+			deps.MITM = tc.mitm
+			if tc.want == "denied" {
+				certPEM, keyPEM, _ := httpapi.GenerateDevCA("test CA", 1)
+				ca, _ := httpapi.LoadCertAuthorityFromPEM(certPEM, keyPEM)
+				deps.MITM = &httpapi.MITM{CA: ca, DenySuffix: []string{"127.0.0.1"}}
+			}
+			proxyURL, _ := url.Parse(app.URL)
+			tr := &http.Transport{
+				Proxy:             http.ProxyURL(proxyURL),
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, ServerName: "api.example.test"},
+				ForceAttemptHTTP2: true,
+			}
+			resp, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get(upstream.URL + "/x")
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			tr.CloseIdleConnections()
+			if string(b) != "opaque" {
+				t.Fatalf("unexpected body %q", b)
+			}
+
+			s := waitTunnelSession(t, app)
+			if s.Kind != "tunnel" || s.Tunnel == nil || s.Error != nil {
+				t.Fatalf("unexpected session: %+v", s)
+			}
+			ti := s.Tunnel
+			if !ti.TLS || ti.SNI != "api.example.test" || len(ti.ALPN) == 0 || ti.ALPN[0] != "h2" {
+				t.Fatalf("client hello not recorded: %+v", ti)
+			}
+			if ti.BytesUp == 0 || ti.BytesDown == 0 || ti.MITMSkipped != tc.want {
+				t.Fatalf("unexpected tunnel info: %+v", ti)
+			}
+		})
+	}
+}
+
+func TestConnectTunnel_DialFailureRecorded(t *testing.T) {
+	t.Parallel()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+	proxyURL, _ := url.Parse(app.URL)
+	tr := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	_, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get("https://127.0.0.1:1/")
+	if err == nil {
+		t.Fatalf("expected CONNECT to fail")
+	}
+	s := waitTunnelSession(t, app)
+	if s.Kind != "tunnel" || s.Error == nil || s.Tunnel == nil || s.Tunnel.TLS {
+		t.Fatalf("unexpected session: %+v", s)
+	}
+}
+
+func TestConnectTunnel_ShortFirstMessageNotStalled(t *testing.T) {
+	t.Parallel()
+	// a SOCKS5-like server: reads a 3-byte greeting and answers before the client sends more
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(c, greeting); err == nil {
+			_, _ = c.Write([]byte{0x05, 0x00})
+		}
+		_, _ = io.Copy(io.Discard, c)
+	}()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	c, err := net.Dial("tcp", strings.TrimPrefix(app.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	_ = c.SetDeadline(time.Now().Add(3 * time.Second))
+	target := ln.Addr().String()
+	_, _ = c.Write([]byte("CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n\r\n"))
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("connect: %v %v", err, resp)
+	}
+	_, _ = c.Write([]byte{0x05, 0x01, 0x00})
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(br, reply); err != nil || reply[0] != 0x05 {
+		t.Fatalf("no reply through the tunnel: %v %x", err, reply)
+	}
+	c.Close()
+	if s := waitTunnelSession(t, app); s.Tunnel == nil || s.Tunnel.TLS {
+		t.Fatalf("unexpected session: %+v", s)
+	}
+}
@@ -0,0 +1,128 @@
+package integration
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"network-debugger/internal/infrastructure/config"
+)
+
+// chainProxy is a minimal authenticating HTTP proxy (absolute-form + CONNECT) that records what it served.
+type chainProxy struct {
+	mu   sync.Mutex
+	hits []string
+}
+
+func (p *chainProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("u:p")) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="chain"`)
+		w.WriteHeader(http.StatusProxyAuthRequired)
+		return
+	}
+	p.mu.Lock()
+	p.hits = append(p.hits, r.Method+" "+r.Host)
+	p.mu.Unlock()
+	if r.Method == http.MethodConnect {
+		up, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		cc, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = up.Close()
+			return
+		}
+		_, _ = cc.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		go func() { _, _ = io.Copy(up, cc); _ = up.Close() }()
+		_, _ = io.Copy(cc, up)
+		_ = cc.Close()
+		return
+	}
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Authorization")
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, vv := range resp.Header {
+		w.Header()[k] = vv
+	}
+	w.Header().Set("X-Chained", "1")
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func (p *chainProxy) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.hits)
+}
+
+func TestUpstreamProxy_ChainsReverseAndConnect(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("plain")) }))
+	defer upstream.Close()
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("secure")) }))
+	defer tlsUpstream.Close()
+
+	cp := &chainProxy{}
+	proxySrv := httptest.NewServer(cp)
+	defer proxySrv.Close()
+	proxyURL, _ := url.Parse(proxySrv.URL)
+
+	app, _ := startHTTPAppWithConfig(t, config.Config{UpstreamProxy: "http://u:p@" + proxyURL.Host})
+	defer app.Close()
+
+	// reverse proxy: plain http goes to the upstream proxy in absolute-form
+	resp, err := app.Client().Get(app.URL + "/httpproxy/?_target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "plain" || resp.Header.Get("X-Chained") != "1" {
+		t.Fatalf("reverse not chained: status=%d body=%q", resp.StatusCode, body)
+	}
+
+	// forward proxy CONNECT tunnel: debugger dials the target through the upstream proxy
+	appURL, _ := url.Parse(app.URL)
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(appURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	defer client.CloseIdleConnections()
+	resp, err = client.Get(tlsUpstream.URL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "secure" {
+		t.Fatalf("connect body: %q", body)
+	}
+	if cp.count() != 2 {
+		t.Fatalf("expected 2 upstream proxy hits, got %v", cp.hits)
+	}
+
+	// DIRECT rule bypasses the upstream proxy
+	direct, _ := startHTTPAppWithConfig(t, config.Config{UpstreamProxy: "http://u:p@" + proxyURL.Host, UpstreamProxyRules: "127.0.0.0/8,localhost=DIRECT"})
+	defer direct.Close()
+	resp, err = direct.Client().Get(direct.URL + "/httpproxy/?_target=" + url.QueryEscape(upstream.URL))
+	if err != nil {
+		t.Fatalf("direct: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Chained") != "" || cp.count() != 2 {
+		t.Fatalf("DIRECT rule ignored: hits=%v", cp.hits)
+	}
+}
@@ -0,0 +1,161 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"network-debugger/internal/domain"
+	"network-debugger/internal/infrastructure/config"
+	httpapi "network-debugger/internal/infrastructure/httpapi"
+)
+
+// waitPaused polls /_api/v1/ws/paused until a frame of sessionID is held.
+func waitPaused(t *testing.T, app *httptest.Server, sessionID string) httpapi.PausedWSFrame {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		var list struct {
+			Items []httpapi.PausedWSFrame `json:"items"`
+		}
+		apiJSON(t, app, http.MethodGet, "/_api/v1/ws/paused?sessionId="+sessionID, "", &list)
+		if len(list.Items) > 0 {
+			return list.Items[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no paused frame for %s", sessionID)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWSBreakpoints_PauseEditDrop(t *testing.T) {
+	t.Parallel()
+	echoSrv, echoWS := startEchoWSServer(t)
+	defer echoSrv.Close()
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	if code := apiJSON(t, app, http.MethodPost, "/_api/v1/ws/breakpoints", `{"jsonPath":"$[","regex":"x"}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid jsonPath: expected 400, got %d", code)
+	}
+	apiJSON(t, app, http.MethodPost, "/_api/v1/ws/breakpoints", `{"direction":"upstream->client","event":"push"}`, nil)
+	apiJSON(t, app, http.MethodPost, "/_api/v1/ws/breakpoints", `{"direction":"client->upstream","jsonPath":"$.kind","regex":"^secret$"}`, nil)
+
+	mon, _, err := websocket.DefaultDialer.Dial(wsURLFromHTTP(app.URL, "/api/monitor/ws"), nil)
+	if err != nil {
+		t.Fatalf("monitor dial: %v", err)
+	}
+	defer mon.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	monCh := make(chan monitorEvent, 256)
+	readMonitorEvents(t, mon, ctx, monCh)
+
+	c, _, err := websocket.DefaultDialer.Dial(wsURLFromHTTP(app.URL, "/wsproxy")+"?_target="+url.QueryEscape(echoWS), nil)
+	if err != nil {
+		t.Fatalf("proxy dial: %v", err)
+	}
+	defer c.Close()
+	write := func(s string) {
+		t.Helper()
+		if err := c.WriteMessage(websocket.TextMessage, []byte(s)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	received := make(chan string, 16)
+	go func() {
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- string(data)
+		}
+	}()
+	read := func() string {
+		t.Helper()
+		select {
+		case got := <-received:
+			return got
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no message received")
+			return ""
+		}
+	}
+
+	// the echoed push is held on its way back; the next message queues behind it
+	write(`42["push",{"n":1}]`)
+	write(`after-push`)
+	var sessionID string
+	for sessionID == "" {
+		select {
+		case ev := <-monCh:
+			if ev.Type == "ws_frame_paused" {
+				sessionID = ev.ID
+			}
+		case <-ctx.Done():
+			t.Fatalf("no ws_frame_paused event")
+		}
+	}
+	held := waitPaused(t, app, sessionID)
+	if held.Direction != domain.DirectionUpstreamToClient || held.Payload != `42["push",{"n":1}]` || held.Encoding != "text" {
+		t.Fatalf("unexpected paused frame: %+v", held)
+	}
+	select {
+	case got := <-received:
+		t.Fatalf("received %q while the push was held", got)
+	case <-time.After(150 * time.Millisecond):
+	}
+	if code := apiJSON(t, app, http.MethodPost, "/_api/v1/ws/paused?id="+held.ID, `{"action":"edit"}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("edit without payload: expected 400, got %d", code)
+	}
+	if code := apiJSON(t, app, http.MethodPost, "/_api/v1/ws/paused?id="+held.ID, `{"action":"edit","payload":"42[\"push\",{\"n\":2}]"}`, nil); code != http.StatusOK {
+		t.Fatalf("edit: %d", code)
+	}
+	if code := apiJSON(t, app, http.MethodPost, "/_api/v1/ws/paused?id="+held.ID, `{"action":"release"}`, nil); code != http.StatusNotFound {
+		t.Fatalf("second decision: expected 404, got %d", code)
+	}
+	if got := read(); got != `42["push",{"n":2}]` {
+		t.Fatalf("expected the edited push, got %q", got)
+	}
+	if got := read(); got != "after-push" {
+		t.Fatalf("expected the queued message, got %q", got)
+	}
+
+	// dropped client messages never reach the upstream
+	write(`{"kind":"secret"}`)
+	held = waitPaused(t, app, sessionID)
+	apiJSON(t, app, http.MethodPost, "/_api/v1/ws/paused?id="+held.ID, `{"action":"drop"}`, nil)
+	write(`{"kind":"ok"}`)
+	if got := read(); got != `{"kind":"ok"}` {
+		t.Fatalf("expected only the released message, got %q", got)
+	}
+
+	var frames struct {
+		Items []domain.Frame `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/api/sessions/"+sessionID+"/frames?limit=100", "", &frames)
+	var edited, dropped int
+	for _, f := range frames.Items {
+		if f.Edited {
+			edited++
+		}
+		if f.Dropped {
+			dropped++
+			if f.Direction != domain.DirectionClientToUpstream {
+				t.Fatalf("unexpected dropped frame: %+v", f)
+			}
+		}
+	}
+	if edited != 1 || dropped != 1 {
+		t.Fatalf("expected one edited and one dropped frame, got %d/%d: %+v", edited, dropped, frames.Items)
+	}
+}
@@ -0,0 +1,188 @@
+package integration
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"network-debugger/internal/domain"
+	"network-debugger/internal/infrastructure/config"
+)
+
+// startRecordingWSServer accepts one WebSocket and reports what it receives as "text:…",
+// "binary:…", "ping:…" and "close:<code>:<reason>".
+func startRecordingWSServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	got := make(chan string, 32)
+	up := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.SetPingHandler(func(p string) error {
+			got <- "ping:" + p
+			return c.WriteControl(websocket.PongMessage, []byte(p), time.Now().Add(time.Second))
+		})
+		for {
+			mt, data, err := c.ReadMessage()
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				got <- "close:" + strconv.Itoa(ce.Code) + ":" + ce.Text
+				return
+			}
+			if err != nil {
+				return
+			}
+			if mt == websocket.BinaryMessage {
+				got <- "binary:" + string(data)
+			} else {
+				got <- "text:" + string(data)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + srv.URL[len("http"):], got
+}
+
+func TestWSInject_FramesAndSocketIOEmit(t *testing.T) {
+	t.Parallel()
+	upstreamWS, upstreamGot := startRecordingWSServer(t)
+	app, _ := startHTTPAppWithConfig(t, config.Config{})
+	defer app.Close()
+
+	c, _, err := websocket.DefaultDialer.Dial(wsURLFromHTTP(app.URL, "/wsproxy")+"?_target="+url.QueryEscape(upstreamWS), nil)
+	if err != nil {
+		t.Fatalf("proxy dial: %v", err)
+	}
+	defer c.Close()
+	clientPings := make(chan string, 4)
+	c.SetPingHandler(func(p string) error {
+		clientPings <- p
+		return nil
+	})
+	clientGot := make(chan string, 8)
+	go func() {
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			clientGot <- string(data)
+		}
+	}()
+
+	var sessionID string
+	deadline := time.Now().Add(3 * time.Second)
+	for sessionID == "" {
+		var list struct {
+			Items []domain.Session `json:"items"`
+		}
+		apiJSON(t, app, http.MethodGet, "/_api/v1/sessions?limit=10", "", &list)
+		for _, s := range list.Items {
+			if s.Kind == "ws" {
+				sessionID = s.ID
+			}
+		}
+		if sessionID == "" && time.Now().After(deadline) {
+			t.Fatalf("no ws session")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	send := func(action, body string) int {
+		t.Helper()
+		return apiJSON(t, app, http.MethodPost, "/api/sessions/"+sessionID+"/ws/"+action, body, nil)
+	}
+	// the session is listed before the upstream dial completes; wait until it is live
+	for send("send", `{"direction":"client->upstream","opcode":"binary","payload":"AQID","encoding":"base64"}`) != http.StatusNoContent {
+		if time.Now().After(deadline) {
+			t.Fatalf("session never became live")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	expect := func(ch <-chan string, want string) {
+		t.Helper()
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	expect(upstreamGot, "binary:\x01\x02\x03")
+
+	for _, body := range []string{
+		`{"direction":"client->upstream","opcode":"ping","payload":"` + strings.Repeat("a", 126) + `"}`,
+		`{"direction":"client->upstream","opcode":"frame"}`,
+		`{"direction":"sideways","payload":"x"}`,
+		`{"direction":"client->upstream","opcode":"close","code":1005}`,
+		`{"direction":"client->upstream","opcode":"close","code":2000}`,
+	} {
+		if code := send("send", body); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, code)
+		}
+	}
+	if code := send("emit", `{"direction":"client->upstream","args":[1]}`); code != http.StatusBadRequest {
+		t.Fatalf("emit without event: expected 400, got %d", code)
+	}
+
+	if code := send("send", `{"direction":"client->upstream","opcode":"ping","payload":"hi"}`); code != http.StatusNoContent {
+		t.Fatalf("ping: %d", code)
+	}
+	expect(upstreamGot, "ping:hi")
+	if code := send("emit", `{"direction":"client->upstream","namespace":"/chat","event":"hello","args":[{"a":1},"b"],"ackId":3}`); code != http.StatusNoContent {
+		t.Fatalf("emit: %d", code)
+	}
+	expect(upstreamGot, `text:42/chat,3["hello",{"a":1},"b"]`)
+	if code := send("send", `{"direction":"upstream->client","opcode":"ping","payload":"yo"}`); code != http.StatusNoContent {
+		t.Fatalf("ping to client: %d", code)
+	}
+	expect(clientPings, "yo")
+	if code := send("emit", `{"direction":"upstream->client","event":"push","args":[]}`); code != http.StatusNoContent {
+		t.Fatalf("emit to client: %d", code)
+	}
+	expect(clientGot, `42["push"]`)
+
+	var events struct {
+		Items []domain.Event `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/api/sessions/"+sessionID+"/events?limit=50", "", &events)
+	var hello bool
+	for _, e := range events.Items {
+		if e.Name == "hello" && e.Namespace == "/chat" && e.AckID != nil && *e.AckID == 3 {
+			hello = true
+		}
+	}
+	if !hello {
+		t.Fatalf("emitted event not decoded: %+v", events.Items)
+	}
+
+	if code := send("send", `{"direction":"client->upstream","opcode":"close","code":4001,"reason":"bye"}`); code != http.StatusNoContent {
+		t.Fatalf("close: %d", code)
+	}
+	expect(upstreamGot, "close:4001:bye")
+
+	var frames struct {
+		Items []domain.Frame `json:"items"`
+	}
+	apiJSON(t, app, http.MethodGet, "/api/sessions/"+sessionID+"/frames?limit=50", "", &frames)
+	injected := map[domain.Opcode]int{}
+	for _, f := range frames.Items {
+		if f.Injected {
+			injected[f.Opcode]++
+		}
+	}
+	if injected[domain.OpcodeBinary] != 1 || injected[domain.OpcodePing] != 2 || injected[domain.OpcodeText] != 2 || injected[domain.OpcodeClose] != 1 {
+		t.Fatalf("unexpected injected frames: %v", injected)
+	}
+}
@@ -13,6 +13,8 @@ type SessionRepository interface {
 	ListSessions(ctx context.Context, f SessionFilter) ([]domain.Session, int, error)
 	IncrementCounters(ctx context.Context, id string, frame domain.Frame) error
 	SetClosed(ctx context.Context, id string, closedAt time.Time, errMsg *string) error
+	// UpdateSession applies fn to the stored session under the repository lock (no-op for unknown ids).
+	UpdateSession(ctx context.Context, id string, fn func(*domain.Session)) error
 	ClearAllSessions(ctx context.Context) error
 }
 
@@ -29,6 +31,7 @@ type EventRepository interface {
 type HTTPTransactionRepository interface {
 	AppendHTTPTransaction(ctx context.Context, tx domain.HTTPTransaction) error
 	ListHTTPTransactions(ctx context.Context, sessionID string, from string, limit int) ([]domain.HTTPTransaction, string, error)
+	UpdateHTTPTransaction(ctx context.Context, tx domain.HTTPTransaction) error
 }
 
 // Optional repository for capture control (in-memory MVP)
@@ -47,4 +50,7 @@ type SessionFilter struct {
 	Offset            int
 	CaptureID         *int // nil: any; -1 means current; otherwise exact id
 	IncludeUnassigned bool // include sessions with CaptureID==nil
+	ChainID           string
+	User              string // exact proxy user
+	ClientID          string // exact client id (see /_api/v1/clients)
 }
@@ -69,6 +69,11 @@ func (s *SessionService) SetClosed(ctx context.Context, id string, closedAt time
 	return s.sessions.SetClosed(ctx, id, closedAt, errMsg)
 }
 
+// UpdateSession mutates session metadata discovered after creation (e.g. dialed server IP).
+func (s *SessionService) UpdateSession(ctx context.Context, id string, fn func(*domain.Session)) error {
+	return s.sessions.UpdateSession(ctx, id, fn)
+}
+
 func (s *SessionService) AddHTTPTransaction(ctx context.Context, tx domain.HTTPTransaction) error {
 	if s.httpTxs == nil {
 		return nil
@@ -76,6 +81,15 @@ func (s *SessionService) AddHTTPTransaction(ctx context.Context, tx domain.HTTPT
 	return s.httpTxs.AppendHTTPTransaction(ctx, tx)
 }
 
+// UpdateHTTPTransaction replaces a stored transaction (matched by session and ID), e.g. once
+// the response body finished streaming and final timings are known.
+func (s *SessionService) UpdateHTTPTransaction(ctx context.Context, tx domain.HTTPTransaction) error {
+	if s.httpTxs == nil {
+		return nil
+	}
+	return s.httpTxs.UpdateHTTPTransaction(ctx, tx)
+}
+
 func (s *SessionService) ListHTTPTransactions(ctx context.Context, sessionID string, from string, limit int) ([]domain.HTTPTransaction, string, error) {
 	if s.httpTxs == nil {
 		return nil, "", nil